@@ -1,26 +1,49 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"mcrunner"
 	"os"
-	"path/filepath"
 	"sync"
 )
 
 func main() {
+	printConfig, err := mcrunner.ConfigureOverrides(os.Environ(), os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	settings, err := mcrunner.LoadSettings()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if printConfig {
+		err = mcrunner.PrintConfig(settings)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	fmt.Println("Starting server...")
 	runner := new(mcrunner.McRunner)
-	runner.Settings = loadSettings()
+	runner.Settings = settings
 	runner.StatusRequestChannel = make(chan bool, 1)
 	runner.StatusChannel = make(chan *mcrunner.Status, 1)
 	runner.MessageChannel = make(chan string, 32)
-	runner.CommandChannel = make(chan string, 32)
+	runner.CommandChannel = make(chan *mcrunner.Command, 32)
+	runner.SettingsChannel = make(chan *mcrunner.SettingsRequest, 8)
+	runner.AccessChannel = make(chan *mcrunner.AccessRequest, 8)
+	runner.ResponseChannel = make(chan *mcrunner.Response, 32)
 	runner.FirstStart = true
 	runner.WaitGroup = sync.WaitGroup{}
 	go runner.Start()
+	go runner.WatchSettings()
 
 	bothandler := new(mcrunner.BotHandler)
 	bothandler.McRunner = runner
@@ -29,31 +52,3 @@ func main() {
 	// Prevent the program from exiting while there is still stuff running in the background.
 	runner.WaitGroup.Wait()
 }
-
-func loadSettings() mcrunner.Settings {
-	settingspath := filepath.Join(mcrunner.McServerPath(), "settings.json")
-	_, err := os.Stat(settingspath)
-	defaultSettings := mcrunner.Settings{Directory: "./", Name: "?", MOTD: "?", MaxRAM: 6192, MaxPlayers: 20, Port: 25565, ListenAddress: ":8080", PassthroughStdErr: true, PassthroughStdOut: false}
-
-	if err == nil {
-		file, err := os.Open(settingspath)
-		if err == nil {
-			bytes, _ := ioutil.ReadAll(file)
-			var settings mcrunner.Settings
-			json.Unmarshal(bytes, &settings)
-			return settings
-		}
-	} else if os.IsNotExist(err) {
-		fmt.Println("'settings.json' not found, generating default file.")
-		settingsJSON, _ := json.MarshalIndent(defaultSettings, "", "    ")
-		err = ioutil.WriteFile(settingspath, settingsJSON, 0644)
-		if err != nil {
-			fmt.Print(err)
-		}
-		return defaultSettings
-	}
-
-	fmt.Println(err)
-	fmt.Println("Error opening settings file, using defaults.")
-	return defaultSettings
-}
@@ -0,0 +1,371 @@
+package mcrunner
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// MojangProfileURL looks up the UUID of a player name.
+	MojangProfileURL = "https://api.mojang.com/users/profiles/minecraft/"
+	// UserCacheFile name of the file inside the mcserver directory caching the UUIDs of player names.
+	UserCacheFile = "usercache.json"
+	// DefaultOpLevel is the permission level of operators added without one.
+	DefaultOpLevel = 4
+	// DefaultBanReason is the reason recorded for bans without one, the same as the server's.
+	DefaultBanReason = "Banned by an operator."
+)
+
+// accessLists maps the names of the access lists to their files inside the mcserver directory.
+var accessLists = map[string]string{
+	"whitelist":      "whitelist.json",
+	"ops":            "ops.json",
+	"banned-players": "banned-players.json",
+	"banned-ips":     "banned-ips.json",
+}
+
+// AccessEntry is an entry of one of the access lists, in the format of their files.
+type AccessEntry struct {
+	UUID string `json:"uuid,omitempty"`
+	Name string `json:"name,omitempty"`
+	// IP is set instead of UUID and Name in banned-ips.
+	IP string `json:"ip,omitempty"`
+	// Level and BypassesPlayerLimit are only set in ops.
+	Level               int  `json:"level,omitempty"`
+	BypassesPlayerLimit bool `json:"bypassesPlayerLimit,omitempty"`
+	// Created, Source, Expires and Reason are only set in the ban lists.
+	Created string `json:"created,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Expires string `json:"expires,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// AccessRequest is an "access" message from the Discord bot, reading or changing the whitelist,
+// ops or bans.
+type AccessRequest struct {
+	// List is "whitelist", "ops", "banned-players" or "banned-ips".
+	List string `json:"list"`
+	// Action is "list", "add" or "remove".
+	Action string `json:"action"`
+	// Name is the player to add or remove, or the IP address for banned-ips.
+	Name string `json:"name,omitempty"`
+	// Reason is recorded with bans.
+	Reason string `json:"reason,omitempty"`
+	// Level is the permission level of new ops, which can only be chosen while the server is stopped.
+	Level int `json:"level,omitempty"`
+}
+
+// accessResult is the reply to an AccessRequest, sent as an "access" message.
+type accessResult struct {
+	List    string `json:"list"`
+	Action  string `json:"action"`
+	Name    string `json:"name,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Lists holds every access list after the request, keyed by the list names.
+	Lists map[string][]AccessEntry `json:"lists,omitempty"`
+}
+
+// accessCommand is the console command that adds to or removes from a list, and the output that
+// confirms it. %s in both is replaced with the name or IP.
+type accessCommand struct {
+	command string
+	success string
+}
+
+// accessCommands are keyed by list and then action. The success patterns cover the messages of
+// both current and 1.12 era servers.
+var accessCommands = map[string]map[string]accessCommand{
+	"whitelist": {
+		"add":    {"whitelist add %s", "Added %s to the whitelist"},
+		"remove": {"whitelist remove %s", "Removed %s from the whitelist"},
+	},
+	"ops": {
+		"add":    {"op %s", "(Made %s a server operator|Opped %s)"},
+		"remove": {"deop %s", "(Made %s no longer a server operator|De-opped %s)"},
+	},
+	"banned-players": {
+		"add":    {"ban %s", "Banned (player )?%s"},
+		"remove": {"pardon %s", "Unbanned (player )?%s"},
+	},
+	"banned-ips": {
+		"add":    {"ban-ip %s", "Banned IP (address )?%s"},
+		"remove": {"pardon-ip %s", "Unbanned IP (address )?%s"},
+	},
+}
+
+// serverLogPrefix matches the start of the server's own log lines, "[time] [thread/INFO]: " and
+// Forge's "[time] [thread/INFO] [logger]: " as well as Paper's "[time INFO]: ", so that chat and
+// other players' messages can't pass for the console's replies.
+const serverLogPrefix = "^(?:\\[[^\\]]*\\] )*\\[[^\\]]*(?:INFO|WARN)\\](?: \\[[^\\]]*\\])?: "
+
+// accessFailedExp matches the console's replies to access commands that didn't change anything.
+var accessFailedExp = regexp.MustCompile(serverLogPrefix + "((?:Nothing changed|Could not|That player|Player is already|Player is not|Invalid IP|You must specify|Usage: |Unknown).*)")
+
+// playerNameExp matches valid Minecraft player names.
+var playerNameExp = regexp.MustCompile("^[A-Za-z0-9_]{1,16}$")
+
+// accessListPath returns the path of the file for list.
+func accessListPath(list string) string {
+	return filepath.Join(McServerPath(), accessLists[list])
+}
+
+// ReadAccessList reads the entries of list. A missing file reads as empty.
+func ReadAccessList(list string) ([]AccessEntry, error) {
+	entries := []AccessEntry{}
+	contents, err := ioutil.ReadFile(accessListPath(list))
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contents, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", accessLists[list], err)
+	}
+	return entries, nil
+}
+
+// writeAccessList writes the entries of list, indented like the server writes them.
+func writeAccessList(list string, entries []AccessEntry) error {
+	contents, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(accessListPath(list), contents, 0644)
+}
+
+// readAccessLists reads all the access lists.
+func readAccessLists() (map[string][]AccessEntry, error) {
+	lists := make(map[string][]AccessEntry)
+	for list := range accessLists {
+		entries, err := ReadAccessList(list)
+		if err != nil {
+			return nil, err
+		}
+		lists[list] = entries
+	}
+	return lists, nil
+}
+
+// matchesEntry returns true if entry is for name, a player name or IP address.
+func matchesEntry(entry AccessEntry, name string) bool {
+	if entry.IP != "" {
+		return entry.IP == name
+	}
+	return strings.EqualFold(entry.Name, name)
+}
+
+// offlineUUID returns the UUID an offline mode server gives the player called name.
+func offlineUUID(name string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return formatUUID(fmt.Sprintf("%x", sum))
+}
+
+// formatUUID adds the dashes to a UUID written as 32 hex digits.
+func formatUUID(hex string) string {
+	if len(hex) != 32 {
+		return hex
+	}
+	return hex[0:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:32]
+}
+
+// lookupPlayer returns the UUID and correctly capitalized name of the player called name. Players
+// already known to the server are found in its user cache, others are looked up with Mojang unless
+// the server is in offline mode.
+func (runner *McRunner) lookupPlayer(name string) (string, string, error) {
+	var cache []struct {
+		Name string `json:"name"`
+		UUID string `json:"uuid"`
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(McServerPath(), UserCacheFile)); err == nil {
+		json.Unmarshal(contents, &cache)
+	}
+	for _, player := range cache {
+		if strings.EqualFold(player.Name, name) {
+			return player.UUID, player.Name, nil
+		}
+	}
+
+	props, err := ReadProperties(PropertiesPath())
+	if err != nil {
+		return "", "", err
+	}
+	if online, _ := props.Get("online-mode"); online == "false" {
+		return offlineUUID(name), name, nil
+	}
+
+	if runner.currentSettings().Offline {
+		return "", "", fmt.Errorf("%s isn't in %s and Mojang can't be asked while offline", name, UserCacheFile)
+	}
+	profile := new(struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	})
+	err = fetchJSON(runner.mirrorURL(MojangProfileURL+name), profile)
+	if err != nil || profile.ID == "" {
+		fmt.Println("lookupPlayer: fetchJSON:", err)
+		return "", "", fmt.Errorf("couldn't find a Minecraft account called %s", name)
+	}
+	return formatUUID(profile.ID), profile.Name, nil
+}
+
+// editAccessList adds or removes name in the file for list, for while the server is stopped.
+func (runner *McRunner) editAccessList(request *AccessRequest) error {
+	entries, err := ReadAccessList(request.List)
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, entry := range entries {
+		if matchesEntry(entry, request.Name) {
+			index = i
+		}
+	}
+
+	if request.Action == "remove" {
+		if index < 0 {
+			return fmt.Errorf("%s isn't in %s", request.Name, request.List)
+		}
+		entries = append(entries[:index], entries[index+1:]...)
+		return writeAccessList(request.List, entries)
+	}
+	if index >= 0 && (request.List != "ops" || request.Level == 0 || entries[index].Level == request.Level) {
+		return fmt.Errorf("%s is already in %s", request.Name, request.List)
+	}
+
+	entry := AccessEntry{}
+	if index >= 0 {
+		// Only an op's level can be changed by adding them again.
+		entry = entries[index]
+	} else if request.List == "banned-ips" {
+		entry.IP = request.Name
+	} else {
+		entry.UUID, entry.Name, err = runner.lookupPlayer(request.Name)
+		if err != nil {
+			return err
+		}
+	}
+	switch request.List {
+	case "ops":
+		entry.Level = request.Level
+		if entry.Level == 0 {
+			entry.Level = DefaultOpLevel
+		}
+	case "banned-players", "banned-ips":
+		entry.Created = time.Now().Format("2006-01-02 15:04:05 -0700")
+		entry.Source = "Server"
+		entry.Expires = "forever"
+		entry.Reason = request.Reason
+		if entry.Reason == "" {
+			entry.Reason = DefaultBanReason
+		}
+	}
+
+	if index >= 0 {
+		entries[index] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+	return writeAccessList(request.List, entries)
+}
+
+// consoleAccess adds or removes name through the console, for while the server is running, and
+// waits for the output confirming it.
+func (runner *McRunner) consoleAccess(request *AccessRequest) error {
+	if request.Level != 0 {
+		return fmt.Errorf("the op level can only be chosen while the server is stopped, running servers use op-permission-level")
+	}
+
+	command := accessCommands[request.List][request.Action]
+	line := fmt.Sprintf(command.command, request.Name)
+	if request.Action == "add" && request.Reason != "" && strings.HasPrefix(request.List, "banned-") {
+		line += " " + request.Reason
+	}
+	success := regexp.MustCompile("(?i)" + serverLogPrefix + strings.Replace(command.success, "%s", regexp.QuoteMeta(request.Name), -1) + "\\b")
+
+	var failure string
+	err := runner.executeAndWait(line, ConsoleTimeout, func(line string) bool {
+		if success.MatchString(line) {
+			return true
+		}
+		if match := accessFailedExp.FindStringSubmatch(line); match != nil {
+			failure = match[1]
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if failure != "" {
+		return fmt.Errorf("%s", failure)
+	}
+	return nil
+}
+
+// ChangeAccess runs an AccessRequest, through the console while the server is running or by
+// editing the list's file while it is stopped, and returns all the lists afterwards.
+func (runner *McRunner) ChangeAccess(request *AccessRequest) (map[string][]AccessEntry, error) {
+	if request.Action != "list" {
+		if _, ok := accessLists[request.List]; !ok {
+			return nil, fmt.Errorf("unknown list %q, it must be whitelist, ops, banned-players or banned-ips", request.List)
+		}
+		if request.Action != "add" && request.Action != "remove" {
+			return nil, fmt.Errorf("unknown action %q, it must be list, add or remove", request.Action)
+		}
+		if request.List == "banned-ips" && net.ParseIP(request.Name) == nil {
+			return nil, fmt.Errorf("%q is not an IP address", request.Name)
+		}
+		if request.List != "banned-ips" && !playerNameExp.MatchString(request.Name) {
+			return nil, fmt.Errorf("%q is not a player name", request.Name)
+		}
+		// A line break would end the console command early and run the rest as another one.
+		if strings.ContainsAny(request.Reason, "\r\n") {
+			return nil, fmt.Errorf("the ban reason must be a single line")
+		}
+		if request.Level < 0 || request.Level > 4 {
+			return nil, fmt.Errorf("op level %d must be between 1 and 4", request.Level)
+		}
+
+		var err error
+		switch runner.state() {
+		case Running:
+			err = runner.consoleAccess(request)
+		case NotRunning:
+			err = runner.editAccessList(request)
+		default:
+			err = fmt.Errorf("wait for the server to finish starting")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return readAccessLists()
+}
+
+// handleAccessRequest answers an "access" message with an "access" message.
+func (runner *McRunner) handleAccessRequest(request *AccessRequest) {
+	result := accessResult{List: request.List, Action: request.Action, Name: request.Name}
+	lists, err := runner.ChangeAccess(request)
+	if err != nil {
+		fmt.Println("access:", err)
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+		result.Lists = lists
+	}
+	runner.respond("access", result)
+}
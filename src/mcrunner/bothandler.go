@@ -15,9 +15,27 @@ type header struct {
 	Data json.RawMessage `json:"data"`
 }
 
-// command defines the structure of a command message from the Discord bot.
-type command struct {
+// Command defines the structure of a command message from the Discord bot.
+type Command struct {
 	Command string `json:"cmd"`
+	// Data is an optional file uploaded with the command, base64 encoded in the JSON.
+	Data []byte `json:"data,omitempty"`
+	// Reboot schedules a reboot if the command changed something that needs one to take effect.
+	Reboot bool `json:"reboot,omitempty"`
+}
+
+// Response is a message from the runner to the Discord bot, sent with Type as the header type.
+type Response struct {
+	Type string
+	Data interface{}
+}
+
+// result defines the structure of the reply to a command handled by the runner itself.
+type result struct {
+	Command string      `json:"cmd"`
+	Success bool        `json:"success"`
+	Error   string      `json:"error,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 // message defines the structure of a message to the Discord bot.
@@ -41,7 +59,8 @@ func (handler *BotHandler) Start() error {
 	handler.connectionAlive = false
 
 	// Listen for the bot to establish a connection with us.
-	s := http.Server{Addr: handler.McRunner.Settings.ListenAddress, Handler: nil}
+	s := http.Server{Addr: handler.McRunner.currentSettings().ListenAddress, Handler: nil}
+	http.HandleFunc(ResourcePackPath, handler.McRunner.serveResourcePack)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// Upgrade HTTP request to a websocket connection.
 		upgrader := websocket.Upgrader{}
@@ -123,13 +142,30 @@ func (handler *BotHandler) listen() {
 
 			switch header.Type {
 			case "cmd":
-				command := new(command)
+				command := new(Command)
 				err := json.Unmarshal(header.Data, command)
 				if err != nil {
 					fmt.Println(err)
 					break
 				}
-				handler.McRunner.CommandChannel <- command.Command
+				handler.McRunner.CommandChannel <- command
+			case "settings.get", "settings.set":
+				request := new(SettingsRequest)
+				err := json.Unmarshal(header.Data, request)
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+				request.Set = header.Type == "settings.set"
+				handler.McRunner.SettingsChannel <- request
+			case "access":
+				request := new(AccessRequest)
+				err := json.Unmarshal(header.Data, request)
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+				handler.McRunner.AccessChannel <- request
 			}
 		case <-handler.killChannel:
 			return
@@ -144,7 +180,7 @@ func (handler *BotHandler) updateStatus() {
 	defer handler.McRunner.WaitGroup.Done()
 	for {
 		select {
-		case <-time.After(60 * time.Second):
+		case <-time.After(time.Duration(handler.McRunner.currentSettings().StatusInterval) * time.Second):
 			handler.McRunner.StatusRequestChannel <- true
 
 			select {
@@ -162,7 +198,7 @@ func (handler *BotHandler) updateStatus() {
 	}
 }
 
-// handleMessages forwards chat messages from the mc server to the discord bot.
+// handleMessages forwards chat messages and responses from the mc server to the discord bot.
 func (handler *BotHandler) handleMessages() {
 	handler.McRunner.WaitGroup.Add(1)
 	defer handler.McRunner.WaitGroup.Done()
@@ -173,6 +209,14 @@ func (handler *BotHandler) handleMessages() {
 			messageJSON, _ := json.Marshal(message)
 			header := header{Type: "msg", Data: messageJSON}
 			handler.sock.WriteJSON(header)
+		case response := <-handler.McRunner.ResponseChannel:
+			responseJSON, err := json.Marshal(response.Data)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			header := header{Type: response.Type, Data: responseJSON}
+			handler.sock.WriteJSON(header)
 		case <-handler.killChannel:
 			return
 		}
@@ -0,0 +1,198 @@
+package mcrunner
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mirrorURL rewrites netpath using the longest matching prefix in Settings.Mirrors.
+func (runner *McRunner) mirrorURL(netpath string) string {
+	settings := runner.currentSettings()
+	prefixes := make([]string, 0, len(settings.Mirrors))
+	for prefix := range settings.Mirrors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(netpath, prefix) {
+			return settings.Mirrors[prefix] + netpath[len(prefix):]
+		}
+	}
+	return netpath
+}
+
+// cachePath returns where netpath is stored in the artifact cache, or "" if there is no cache.
+// Files are keyed by their original URL, so changing mirrors doesn't invalidate the cache.
+func (runner *McRunner) cachePath(netpath string) string {
+	settings := runner.currentSettings()
+	if settings.CacheDirectory == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(netpath)
+	if err != nil || parsed.Host == "" {
+		sum := sha1.Sum([]byte(netpath))
+		return filepath.Join(settings.CacheDirectory, "other", hex.EncodeToString(sum[:]))
+	}
+
+	path := filepath.Join(settings.CacheDirectory, parsed.Host, filepath.FromSlash(parsed.Path))
+	if parsed.RawQuery != "" || strings.HasSuffix(parsed.Path, "/") {
+		sum := sha1.Sum([]byte(parsed.RawQuery))
+		path += "_" + hex.EncodeToString(sum[:4])
+	}
+	return path
+}
+
+// Download performs download through the configured mirrors and artifact cache.
+// With a cache, the file is fetched into the cache once and then linked or copied to LocalPath,
+// and in Offline mode only the cache is used.
+func (runner *McRunner) Download(download Download) error {
+	settings := runner.currentSettings()
+	if download.Progress == nil && runner.state() == Installing {
+		download.Progress = runner.downloadProgress(download.LocalPath)
+	}
+
+	cachepath := runner.cachePath(download.URL)
+	download.URL = runner.mirrorURL(download.URL)
+	if cachepath == "" {
+		if settings.Offline {
+			return fmt.Errorf("%s: offline and no CacheDirectory is set", download.URL)
+		}
+		return download.Run()
+	}
+
+	if download.ReturnIfExists {
+		info, err := os.Stat(download.LocalPath)
+		if err == nil && info.Size() > 0 && download.Checksum.Verify(download.LocalPath) == nil {
+			return nil
+		}
+	}
+
+	if settings.Offline {
+		_, err := os.Stat(cachepath)
+		if err != nil {
+			return fmt.Errorf("%s: offline and not in cache: %s", download.URL, err)
+		}
+		err = download.Checksum.Verify(cachepath)
+		if err != nil {
+			return err
+		}
+	} else if info, err := os.Stat(cachepath); err != nil || info.Size() == 0 || download.Checksum.Verify(cachepath) != nil {
+		err = downloadToCache(download, cachepath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return linkOrCopy(cachepath, download.LocalPath)
+}
+
+// downloadFile downloads netpath to localpath through the mirrors and cache, without a checksum.
+func (runner *McRunner) downloadFile(localpath, netpath string, returnIfExists bool) error {
+	return runner.Download(Download{LocalPath: localpath, URL: netpath, ReturnIfExists: returnIfExists})
+}
+
+// fetchJSON fetches url through the mirrors and decodes it into v. With a cache, the response is
+// saved so it can be used when offline or when the network request fails.
+func (runner *McRunner) fetchJSON(netpath string, v interface{}) error {
+	settings := runner.currentSettings()
+	cachepath := runner.cachePath(netpath)
+	if cachepath == "" {
+		if settings.Offline {
+			return fmt.Errorf("%s: offline and no CacheDirectory is set", netpath)
+		}
+		return fetchJSON(runner.mirrorURL(netpath), v)
+	}
+
+	if !settings.Offline {
+		// Always refresh metadata when online, it changes as new versions are released.
+		err := downloadToCache(Download{URL: runner.mirrorURL(netpath)}, cachepath)
+		if err != nil {
+			fmt.Println("fetchJSON: falling back to cache:", err)
+		}
+	}
+
+	bytes, err := ioutil.ReadFile(cachepath)
+	if err != nil {
+		return fmt.Errorf("%s: not in cache: %s", netpath, err)
+	}
+	return json.Unmarshal(bytes, v)
+}
+
+// downloadToCache runs download into a temporary file unique to this runner, then renames it to
+// cachepath. Runners sharing a CacheDirectory can fetch the same file at once without writing to
+// or renaming each other's partial files.
+func downloadToCache(download Download, cachepath string) error {
+	err := os.MkdirAll(filepath.Dir(cachepath), 0755)
+	if err != nil {
+		return err
+	}
+	tmpfile, err := ioutil.TempFile(filepath.Dir(cachepath), filepath.Base(cachepath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpfile.Close()
+
+	download.LocalPath = tmpfile.Name()
+	download.ReturnIfExists = false
+	err = download.Run()
+	if err == nil {
+		err = os.Rename(download.LocalPath, cachepath)
+	}
+	if err != nil {
+		os.Remove(download.LocalPath)
+		removePartial(download.LocalPath + partialSuffix)
+	}
+	return err
+}
+
+// linkOrCopy hard links src to dst so cached files aren't duplicated, copying when linking fails
+// (e.g. the cache is on another filesystem).
+func linkOrCopy(src, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(dst)
+	if os.Link(src, dst) == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// copyFile copies src to dst through a partial file, so dst is never left half written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmppath := dst + partialSuffix
+	out, err := os.Create(tmppath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmppath)
+		return err
+	}
+	return os.Rename(tmppath, dst)
+}
@@ -0,0 +1,43 @@
+package mcrunner
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDownloadSharedCache(t *testing.T) {
+	dir := useTempRoot(t)
+	server := serveDownload(t, "\"v1\"", nil)
+	cache := filepath.Join(dir, "cache")
+
+	// Runners sharing the cache fetch the same file at once without clobbering each other.
+	var wait sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			runner := &McRunner{Settings: Settings{CacheDirectory: cache}}
+			localpath := filepath.Join(dir, "server", string(rune('a'+i)), "file.jar")
+			errs[i] = runner.Download(Download{LocalPath: localpath, URL: server.URL + "/file.jar", Checksum: SHA1(sha1Hex(testDownload))})
+		}(i)
+	}
+	wait.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, _ := ioutil.ReadFile(filepath.Join(dir, "server", string(rune('a'+i)), "file.jar"))
+		if string(contents) != testDownload {
+			t.Errorf("runner %d got %d bytes, want %d", i, len(contents), len(testDownload))
+		}
+	}
+	want := []string{filepath.ToSlash(filepath.Join(filepath.Base(server.URL), "file.jar"))}
+	if got := listFiles(t, cache); !reflect.DeepEqual(got, want) {
+		t.Errorf("cache holds %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package mcrunner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RebootDelay is how long players are warned before a reboot scheduled by a command.
+const RebootDelay = 30 * time.Second
+
+// runnerCommand handles a command, receiving the words after the first. It returns the data to
+// send back to the bot in the command's result.
+type runnerCommand func(runner *McRunner, command *Command, args []string) (interface{}, error)
+
+// errResultPending is returned by commands that carry on in the background and send their result
+// with sendResult once they finish.
+var errResultPending = errors.New("result pending")
+
+// runnerCommands are commands handled by the runner itself instead of being passed to the server
+// console, keyed by their first word.
+var runnerCommands map[string]runnerCommand
+
+// Filled in by init, since commands that start the server refer back to handleRunnerCommand.
+func init() {
+	runnerCommands = map[string]runnerCommand{
+		"config":    (*McRunner).configCommand,
+		"datapacks": (*McRunner).datapacksCommand,
+		"import":    (*McRunner).importCommand,
+		"mods":      (*McRunner).modsCommand,
+		"settings":  (*McRunner).settingsCommand,
+		"upgrade":   (*McRunner).upgradeCommand,
+	}
+}
+
+// handleRunnerCommand runs command if it is one of the runnerCommands, returning false if it isn't.
+// The outcome is sent to the bot as a "result" message.
+func (runner *McRunner) handleRunnerCommand(command *Command) bool {
+	args := strings.Fields(command.Command)
+	if len(args) == 0 {
+		return false
+	}
+
+	handler, ok := runnerCommands[args[0]]
+	if !ok {
+		return false
+	}
+
+	data, err := handler(runner, command, args[1:])
+	if err != errResultPending {
+		runner.sendResult(command, data, err)
+	}
+	return true
+}
+
+// sendResult sends the outcome of a runner command to the bot as a "result" message.
+func (runner *McRunner) sendResult(command *Command, data interface{}, err error) {
+	result := result{Command: command.Command, Success: err == nil, Data: data}
+	if err != nil {
+		fmt.Println(fmt.Sprintf("%s:", strings.Fields(command.Command)[0]), err)
+		result.Error = err.Error()
+	}
+	runner.respond("result", result)
+}
+
+// importCommand handles "import <path>", importing a modpack from a file on the runner's host.
+func (runner *McRunner) importCommand(command *Command, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("usage: import <path>")
+	}
+	// Importing replaces the mods and versions the running server was started with.
+	if runner.state() != NotRunning {
+		return nil, fmt.Errorf("stop the server before importing a modpack")
+	}
+
+	return nil, runner.ImportModpack(args[0])
+}
@@ -0,0 +1,293 @@
+package mcrunner
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix starts the names of the environment variables that override Settings fields, e.g.
+// MCRUNNER_MAX_RAM for MaxRAM.
+const EnvPrefix = "MCRUNNER_"
+
+// override sets a Settings field from the environment or the command line.
+type override struct {
+	// source is the environment variable or flag the value came from, for error messages.
+	source string
+	field  string
+	value  string
+}
+
+// overrides are applied over settings.json by LoadSettings, environment variables first so flags
+// take precedence over them.
+var overrides []override
+
+// acronyms are split apart when they run together in a Settings field name, e.g. "PaperAPIURL".
+var acronyms = []string{"API", "URL"}
+
+// settingsWords splits a Settings field name into lower case words, keeping acronyms together,
+// e.g. "CurseForgeAPIKey" is "curse", "forge", "api", "key".
+func settingsWords(name string) []string {
+	var words []string
+	add := func(word string) {
+		for _, acronym := range acronyms {
+			if len(word) > len(acronym) && strings.HasPrefix(word, acronym) && strings.ToUpper(word) == word {
+				words = append(words, strings.ToLower(acronym))
+				word = word[len(acronym):]
+			}
+		}
+		words = append(words, strings.ToLower(word))
+	}
+
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		lowerBefore := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+		acronymEnd := unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsUpper(runes[i]) && (lowerBefore || acronymEnd) {
+			add(string(runes[start:i]))
+			start = i
+		}
+	}
+	add(string(runes[start:]))
+	return words
+}
+
+// settingsEnvName returns the environment variable that overrides the Settings field called name.
+func settingsEnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.Join(settingsWords(name), "_"))
+}
+
+// settingsFlagName returns the command line flag that overrides the Settings field called name.
+func settingsFlagName(name string) string {
+	return strings.Join(settingsWords(name), "-")
+}
+
+// setSettingsField parses value into the Settings field called name. Lists are comma separated and
+// maps are comma separated key=value pairs, or either can be given as JSON.
+func setSettingsField(settings *Settings, name, value string) error {
+	field := reflect.ValueOf(settings).Elem().FieldByName(name)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		field.SetInt(int64(number))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case reflect.Slice, reflect.Map:
+		parsed := reflect.New(field.Type())
+		if strings.HasPrefix(strings.TrimSpace(value), "[") || strings.HasPrefix(strings.TrimSpace(value), "{") {
+			err := json.Unmarshal([]byte(value), parsed.Interface())
+			if err != nil {
+				return err
+			}
+			field.Set(parsed.Elem())
+			return nil
+		}
+
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		if field.Kind() == reflect.Slice {
+			field.Set(reflect.ValueOf(items))
+			return nil
+		}
+		values := make(map[string]string)
+		for _, item := range items {
+			pair := strings.SplitN(item, "=", 2)
+			if len(pair) != 2 {
+				return fmt.Errorf("%q must be key=value", item)
+			}
+			values[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("%s can't be set from a string", name)
+	}
+	return nil
+}
+
+// envOverrides returns the overrides set by MCRUNNER_* variables in environ. Variables that don't
+// name a Settings field are errors, since they are usually typos.
+func envOverrides(environ []string) ([]override, error) {
+	fields := make(map[string]string)
+	settingsType := reflect.TypeOf(Settings{})
+	for i := 0; i < settingsType.NumField(); i++ {
+		fields[settingsEnvName(settingsType.Field(i).Name)] = settingsType.Field(i).Name
+	}
+
+	var found []override
+	var errs SettingsErrors
+	for _, variable := range environ {
+		pair := strings.SplitN(variable, "=", 2)
+		if len(pair) != 2 || !strings.HasPrefix(pair[0], EnvPrefix) {
+			continue
+		}
+		field, ok := fields[pair[0]]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s doesn't match a setting", pair[0]))
+			continue
+		}
+		found = append(found, override{source: pair[0], field: field, value: pair[1]})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return found, nil
+}
+
+// overrideFlag is the flag.Value for a Settings field.
+type overrideFlag struct {
+	field  string
+	isBool bool
+	found  *[]override
+}
+
+func (value *overrideFlag) String() string {
+	return ""
+}
+
+func (value *overrideFlag) Set(s string) error {
+	settings := DefaultSettings()
+	err := setSettingsField(&settings, value.field, s)
+	if err != nil {
+		return err
+	}
+	*value.found = append(*value.found, override{source: "--" + settingsFlagName(value.field), field: value.field, value: s})
+	return nil
+}
+
+// IsBoolFlag lets bool fields be set with just the flag, e.g. --offline.
+func (value *overrideFlag) IsBoolFlag() bool {
+	return value.isBool
+}
+
+// flagOverrides parses the command line, which has a flag for every Settings field, e.g.
+// --max-ram 8192, and --print-config.
+func flagOverrides(args []string, output io.Writer) ([]override, bool, error) {
+	var found []override
+	flags := flag.NewFlagSet("mcrunner", flag.ContinueOnError)
+	flags.SetOutput(output)
+	printConfig := flags.Bool("print-config", false, "print the settings after applying the environment and flags, then exit")
+
+	settingsType := reflect.TypeOf(Settings{})
+	for i := 0; i < settingsType.NumField(); i++ {
+		field := settingsType.Field(i)
+		value := &overrideFlag{field: field.Name, isBool: field.Type.Kind() == reflect.Bool, found: &found}
+		flags.Var(value, settingsFlagName(field.Name), fmt.Sprintf("set %s, overriding %s and %s", field.Name, settingsEnvName(field.Name), SettingsFile))
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, false, err
+	}
+	if flags.NArg() > 0 {
+		return nil, false, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	return found, *printConfig, nil
+}
+
+// ConfigureOverrides reads the MCRUNNER_* environment variables and the command line flags that
+// override settings.json in LoadSettings. The settings are taken from DefaultSettings, then
+// settings.json, then the environment, then the flags. It returns true if --print-config was given.
+func ConfigureOverrides(environ, args []string) (bool, error) {
+	env, err := envOverrides(environ)
+	if err != nil {
+		return false, err
+	}
+	flagged, printConfig, err := flagOverrides(args, os.Stderr)
+	if err != nil {
+		return false, err
+	}
+
+	overrides = append(env, flagged...)
+	return printConfig, nil
+}
+
+// applyOverrides sets the overridden fields of settings.
+func applyOverrides(settings *Settings) error {
+	var errs SettingsErrors
+	for _, o := range overrides {
+		err := setSettingsField(settings, o.field, o.value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", o.source, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkOverrides returns an error if settings changes a field that is overridden, since saving it
+// to settings.json would have no effect.
+func checkOverrides(settings Settings) error {
+	overridden := DefaultSettings()
+	applyOverrides(&overridden)
+
+	var errs SettingsErrors
+	seen := make(map[string]string)
+	for _, o := range overrides {
+		seen[o.field] = o.source
+	}
+	for field, source := range seen {
+		want := reflect.ValueOf(overridden).FieldByName(field).Interface()
+		if !reflect.DeepEqual(reflect.ValueOf(settings).FieldByName(field).Interface(), want) {
+			errs = append(errs, fmt.Sprintf("%s is set by %s, change it there", field, source))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// withoutOverrides returns settings with the overridden fields put back to their values in file,
+// so saving the settings doesn't copy the environment and flags into settings.json.
+func withoutOverrides(settings, file Settings) Settings {
+	settingsValue := reflect.ValueOf(&settings).Elem()
+	fileValue := reflect.ValueOf(file)
+	for _, o := range overrides {
+		settingsValue.FieldByName(o.field).Set(fileValue.FieldByName(o.field))
+	}
+	return settings
+}
+
+// PrintConfig prints settings as JSON with secrets masked, and where each overridden field was set
+// to stderr so the JSON can be piped on its own.
+func PrintConfig(settings Settings) error {
+	settingsValue := reflect.ValueOf(&settings).Elem()
+	for i := 0; i < settingsValue.NumField(); i++ {
+		field := settingsValue.Type().Field(i)
+		if field.Tag.Get("secret") == "true" && settingsValue.Field(i).String() != "" {
+			settingsValue.Field(i).SetString(SecretMask)
+		}
+	}
+
+	settingsJSON, err := json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(settingsJSON))
+	for _, o := range overrides {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("%s set by %s", o.field, o.source))
+	}
+	return nil
+}
@@ -0,0 +1,559 @@
+package mcrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigDirectory name of the mod config directory inside the mcserver directory.
+const ConfigDirectory = "config"
+
+// ConfigFileInfo describes a file in the config directory.
+type ConfigFileInfo struct {
+	// File is the path inside the config directory, with forward slashes.
+	File string `json:"file"`
+	// Format is "cfg" for Forge's legacy format or "toml".
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+}
+
+// ConfigEntry is a setting in a config file.
+type ConfigEntry struct {
+	// Key is the setting's categories or tables and its name, joined by dots.
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	// Type is the type letter of .cfg settings, e.g. "B" for booleans, with "[]" appended for lists.
+	Type string `json:"type,omitempty"`
+	// Comment is the comment above the setting, which usually describes it.
+	Comment string `json:"comment,omitempty"`
+
+	// start and end are the offsets of the value's text in the file.
+	start int
+	end   int
+	// indent is the indentation of the setting's line, used for the items of .cfg lists.
+	indent string
+}
+
+// configEdit is the result of EditConfig.
+type configEdit struct {
+	File string `json:"file"`
+	// Changed are the edited settings with their new values.
+	Changed []ConfigEntry `json:"changed"`
+	// Backup is the copy of the file from before the edit, inside the mcserver directory.
+	Backup          string `json:"backup"`
+	RebootScheduled bool   `json:"rebootscheduled"`
+}
+
+var (
+	// cfgSettingExp matches a setting line of a .cfg file, e.g. "B:enabled=true" or "S:list <".
+	cfgSettingExp = regexp.MustCompile("^([A-Za-z]):(\"[^\"]*\"|[^=<\\s]+)\\s*(=(.*)|<)$")
+	// cfgCategoryExp matches the line opening a category of a .cfg file, e.g. "general {".
+	cfgCategoryExp = regexp.MustCompile("^(\"[^\"]*\"|[^{\\s]+)\\s*\\{$")
+)
+
+// configFormat returns the format of the config file at path, or an empty string if it isn't one.
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cfg":
+		return "cfg"
+	case ".toml":
+		return "toml"
+	}
+	return ""
+}
+
+// configPath returns the path of file inside the config directory, refusing paths that leave it.
+func configPath(file string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(file))
+	if file == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is not a file in %s", file, ConfigDirectory)
+	}
+	if configFormat(cleaned) == "" {
+		return "", fmt.Errorf("%s is not a .cfg or .toml file", file)
+	}
+	return filepath.Join(McServerPath(), ConfigDirectory, cleaned), nil
+}
+
+// ListConfigFiles returns the .cfg and .toml files in the config directory and its subdirectories.
+func ListConfigFiles() ([]ConfigFileInfo, error) {
+	files := []ConfigFileInfo{}
+	root := filepath.Join(McServerPath(), ConfigDirectory)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || configFormat(path) == "" {
+			return nil
+		}
+		relpath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, ConfigFileInfo{File: filepath.ToSlash(relpath), Format: configFormat(path), Size: info.Size()})
+		return nil
+	})
+	return files, err
+}
+
+// unquoteCfgName removes the quotes around a .cfg category or setting name that has spaces.
+func unquoteCfgName(name string) string {
+	if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+// parseCfgConfig reads the settings of a Forge legacy .cfg file.
+func parseCfgConfig(data string) ([]ConfigEntry, error) {
+	var entries []ConfigEntry
+	var categories, comments []string
+	var list *ConfigEntry
+
+	offset := 0
+	for number, line := range strings.SplitAfter(data, "\n") {
+		start := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+
+		if list != nil {
+			if trimmed == ">" {
+				list.end = start
+				entries = append(entries, *list)
+				list = nil
+			} else if trimmed != "" {
+				list.Value = append(list.Value.([]string), trimmed)
+			}
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(trimmed, "#")))
+		case strings.HasPrefix(trimmed, "~"):
+			// Forge's own lines, e.g. "~CONFIG_VERSION: 1.0", which are left as they are.
+		case trimmed == "}":
+			if len(categories) == 0 {
+				return nil, fmt.Errorf("line %d: } without a category", number+1)
+			}
+			categories = categories[:len(categories)-1]
+			comments = nil
+		case cfgSettingExp.MatchString(trimmed):
+			match := cfgSettingExp.FindStringSubmatch(trimmed)
+			entry := ConfigEntry{
+				Key:     strings.Join(append(append([]string{}, categories...), unquoteCfgName(match[2])), "."),
+				Type:    strings.ToUpper(match[1]),
+				Comment: strings.Join(comments, "\n"),
+				indent:  line[:len(line)-len(strings.TrimLeft(line, " \t"))],
+			}
+			comments = nil
+			if match[3] == "<" {
+				entry.Type += "[]"
+				entry.Value = []string{}
+				entry.start = offset
+				list = &entry
+				continue
+			}
+			entry.Value = cfgTyped(entry.Type, strings.TrimSpace(match[4]))
+			entry.start = start + strings.Index(line, "=") + 1
+			entry.end = entry.start + len(strings.TrimRight(line[entry.start-start:], " \t\r\n"))
+			entries = append(entries, entry)
+		case cfgCategoryExp.MatchString(trimmed):
+			categories = append(categories, unquoteCfgName(cfgCategoryExp.FindStringSubmatch(trimmed)[1]))
+			comments = nil
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", number+1, trimmed)
+		}
+	}
+	if list != nil {
+		return nil, fmt.Errorf("list %s is never closed with >", list.Key)
+	}
+	if len(categories) > 0 {
+		return nil, fmt.Errorf("category %s is never closed with }", categories[len(categories)-1])
+	}
+	return entries, nil
+}
+
+// cfgTyped converts the text of a .cfg setting to a bool or number for its type, keeping it as a
+// string if it doesn't parse.
+func cfgTyped(cfgType, raw string) interface{} {
+	switch cfgType {
+	case "B":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	case "I":
+		if i, err := strconv.Atoi(raw); err == nil {
+			return i
+		}
+	case "D":
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+	}
+	return raw
+}
+
+// cfgValue returns the text that sets a .cfg setting of entry's type to value. Lists are given as
+// a JSON array of strings or comma separated.
+func cfgValue(entry ConfigEntry, value string) (string, error) {
+	switch entry.Type {
+	case "B":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", entry.Key)
+		}
+		return strconv.FormatBool(b), nil
+	case "I":
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("%s must be a whole number", entry.Key)
+		}
+	case "D":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("%s must be a number", entry.Key)
+		}
+	}
+	if !strings.HasSuffix(entry.Type, "[]") {
+		if strings.Contains(value, "\n") {
+			return "", fmt.Errorf("%s can't contain a new line", entry.Key)
+		}
+		return value, nil
+	}
+
+	var items []string
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		err := json.Unmarshal([]byte(value), &items)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a JSON array of strings: %s", entry.Key, err)
+		}
+	} else {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	var builder strings.Builder
+	for _, item := range items {
+		if strings.ContainsAny(item, "\r\n") || strings.TrimSpace(item) == ">" {
+			return "", fmt.Errorf("%s can't have the item %q", entry.Key, item)
+		}
+		builder.WriteString(entry.indent + "    " + strings.TrimSpace(item) + "\n")
+	}
+	return builder.String(), nil
+}
+
+// parseTOMLConfig reads the settings of a TOML file. Settings in arrays of tables are left out,
+// since their keys don't say which table they are in.
+func parseTOMLConfig(data string) ([]ConfigEntry, error) {
+	// Checked with the full parser first, the scan below assumes the file is valid.
+	_, err := parseTOML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ConfigEntry
+	var table []string
+	var comments []string
+	inArray := false
+	parser := &tomlParser{data: data, line: 1}
+	for {
+		parser.skipSpace()
+		if parser.eof() {
+			return entries, nil
+		}
+
+		switch parser.peek() {
+		case '\n', '\r':
+			parser.pos++
+		case '#':
+			start := parser.pos
+			parser.skipComment()
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(parser.data[start:parser.pos], "#")))
+		case '[':
+			inArray = parser.hasPrefix("[[")
+			parser.pos++
+			if inArray {
+				parser.pos++
+			}
+			table, err = parser.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			parser.pos++
+			if inArray {
+				parser.pos++
+			}
+			parser.skipSpace()
+			parser.skipComment()
+			comments = nil
+		default:
+			keys, err := parser.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			parser.skipSpace()
+			parser.pos++
+			parser.skipSpace()
+			start := parser.pos
+			value, err := parser.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if !inArray {
+				entries = append(entries, ConfigEntry{
+					Key:     strings.Join(append(append([]string{}, table...), keys...), "."),
+					Value:   value,
+					Comment: strings.Join(comments, "\n"),
+					start:   start,
+					end:     parser.pos,
+				})
+			}
+			// A comment after the value describes it rather than the next setting.
+			parser.skipSpace()
+			parser.skipComment()
+			comments = nil
+		}
+	}
+}
+
+// tomlValue returns the TOML text that sets entry to value. Strings are quoted, other types must
+// be given as they are written in TOML, e.g. true, 5 or ["a", "b"].
+func tomlValue(entry ConfigEntry, value string) (string, error) {
+	if _, ok := entry.Value.(string); ok {
+		quoted := strconv.Quote(value)
+		if strings.ContainsAny(value, "\n\r") || quoted[1:len(quoted)-1] != strings.Replace(strings.Replace(value, "\\", "\\\\", -1), "\"", "\\\"", -1) {
+			return "", fmt.Errorf("%s can only be set to a single line of printable text", entry.Key)
+		}
+		return quoted, nil
+	}
+
+	parser := &tomlParser{data: value, line: 1}
+	parsed, err := parser.parseValue()
+	if err == nil && !parser.eof() {
+		err = fmt.Errorf("unexpected %q", value[parser.pos:])
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %q is not a TOML value: %s", entry.Key, value, err)
+	}
+	if _, ok := parsed.(int64); ok {
+		if _, ok := entry.Value.(float64); ok {
+			// TOML floats need a decimal point or exponent.
+			return value + ".0", nil
+		}
+	}
+	if fmt.Sprintf("%T", parsed) != fmt.Sprintf("%T", entry.Value) {
+		return "", fmt.Errorf("%s must be a %s like %v", entry.Key, tomlTypeName(entry.Value), entry.Value)
+	}
+	return value, nil
+}
+
+// tomlTypeName describes the type of a parsed TOML value for error messages.
+func tomlTypeName(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case int64:
+		return "whole number"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "table"
+	}
+	return "value"
+}
+
+// parseConfig reads the settings of a config file in format.
+func parseConfig(format, data string) ([]ConfigEntry, error) {
+	if format == "cfg" {
+		return parseCfgConfig(data)
+	}
+	return parseTOMLConfig(data)
+}
+
+// ReadConfig returns the settings in a file in the config directory.
+func ReadConfig(file string) ([]ConfigEntry, error) {
+	path, err := configPath(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseConfig(configFormat(path), string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return entries, nil
+}
+
+// EditConfig sets the settings in edits, keyed by ConfigEntry.Key, in a file in the config
+// directory. Only the values change, the rest of the file is left as it is. The file is copied to
+// BackupDirectory first.
+func EditConfig(file string, edits map[string]string) (*configEdit, error) {
+	entries, err := ReadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	path, _ := configPath(file)
+	format := configFormat(path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	type replacement struct {
+		entry ConfigEntry
+		text  string
+	}
+	var replacements []replacement
+	for key, value := range edits {
+		var matches []ConfigEntry
+		for _, entry := range entries {
+			if entry.Key == key {
+				matches = append(matches, entry)
+			}
+		}
+		if len(matches) != 1 {
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s has no setting %s", file, key)
+			}
+			return nil, fmt.Errorf("%s sets %s more than once", file, key)
+		}
+
+		var text string
+		if format == "cfg" {
+			text, err = cfgValue(matches[0], value)
+		} else {
+			text, err = tomlValue(matches[0], value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		replacements = append(replacements, replacement{matches[0], text})
+	}
+
+	// Replaced from the end of the file so the earlier offsets stay valid.
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].entry.start > replacements[j].entry.start })
+	contents := string(data)
+	for _, r := range replacements {
+		contents = contents[:r.entry.start] + r.text + contents[r.entry.end:]
+	}
+
+	// The edited file must still parse, or the mod would reset it to its defaults.
+	edited, err := parseConfig(format, contents)
+	if err != nil {
+		return nil, fmt.Errorf("%s would be broken by the edit: %s", file, err)
+	}
+
+	// Edits within the same second get their own directory rather than overwriting the first backup.
+	stamp := "config-" + time.Now().Format("20060102-150405")
+	backup := filepath.Join(BackupDirectory, stamp, filepath.FromSlash(file))
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(McServerPath(), backup)); err != nil {
+			break
+		}
+		backup = filepath.Join(BackupDirectory, fmt.Sprintf("%s-%d", stamp, i), filepath.FromSlash(file))
+	}
+	err = os.MkdirAll(filepath.Dir(filepath.Join(McServerPath(), backup)), 0755)
+	if err == nil {
+		err = copyFile(path, filepath.Join(McServerPath(), backup))
+	}
+	if err != nil {
+		fmt.Println("EditConfig: backup:", err)
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(path+partialSuffix, []byte(contents), 0644)
+	if err == nil {
+		err = os.Rename(path+partialSuffix, path)
+	}
+	if err != nil {
+		fmt.Println("EditConfig: WriteFile:", err)
+		return nil, err
+	}
+
+	result := &configEdit{File: file, Changed: []ConfigEntry{}, Backup: filepath.ToSlash(backup)}
+	for _, entry := range edited {
+		if _, ok := edits[entry.Key]; ok {
+			result.Changed = append(result.Changed, entry)
+		}
+	}
+	fmt.Println(fmt.Sprintf("Edited %s, the previous version is in %s", file, backup))
+	return result, nil
+}
+
+// configCommand handles "config list", "config get <file> [key]" and "config set <file> <key>
+// <value>". Several settings can be set at once by uploading a JSON object of keys and values as
+// the command's Data instead of giving a key and value. Setting is refused while the server is
+// running unless the command asks for a reboot, since mods rewrite their configs as they shut down.
+func (runner *McRunner) configCommand(command *Command, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: config list|get|set")
+	}
+
+	switch args[0] {
+	case "list":
+		return ListConfigFiles()
+	case "get":
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("usage: config get <file> [key]")
+		}
+		entries, err := ReadConfig(args[1])
+		if err != nil || len(args) == 2 {
+			return entries, err
+		}
+		for _, entry := range entries {
+			if entry.Key == args[2] {
+				return entry, nil
+			}
+		}
+		return nil, fmt.Errorf("%s has no setting %s", args[1], args[2])
+	case "set":
+		edits := make(map[string]string)
+		if len(args) == 2 && len(command.Data) > 0 {
+			err := json.Unmarshal(command.Data, &edits)
+			if err != nil {
+				return nil, fmt.Errorf("the uploaded edits must be a JSON object of keys and string values: %s", err)
+			}
+		} else if len(args) >= 4 {
+			edits[args[2]] = strings.Join(args[3:], " ")
+		} else {
+			return nil, fmt.Errorf("usage: config set <file> <key> <value>")
+		}
+		if !command.Reboot && runner.state() != NotRunning {
+			return nil, fmt.Errorf("stop the server or ask for a reboot before changing configs, mods may overwrite them when they shut down")
+		}
+
+		result, err := EditConfig(args[1], edits)
+		if err != nil {
+			return nil, err
+		}
+		err = pruneBackups("config-", runner.currentSettings().BackupsKept)
+		if err != nil {
+			fmt.Println("config: pruneBackups:", err)
+		}
+		// Mods read their configs when the server starts.
+		if command.Reboot && runner.state() != NotRunning {
+			runner.ScheduleReboot(RebootDelay)
+			result.RebootScheduled = true
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unknown config command %q", args[0])
+}
@@ -0,0 +1,318 @@
+package mcrunner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// configValues returns the keys and values of entries.
+func configValues(entries []ConfigEntry) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, entry := range entries {
+		values[entry.Key] = entry.Value
+	}
+	return values
+}
+
+const testCfg = `# Configuration file
+
+~CONFIG_VERSION: 0.1.0
+
+general {
+    # Enables the mod
+    B:enabled=true
+
+    # How far it reaches
+    I:range=16
+    D:speed=1.5
+    S:"display name"=Some Name
+
+    "nested category" {
+        S:blocks <
+            minecraft:stone
+            minecraft:dirt
+         >
+    }
+
+}
+`
+
+func TestParseCfgConfig(t *testing.T) {
+	entries, err := parseCfgConfig(testCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"general.enabled":                true,
+		"general.range":                  16,
+		"general.speed":                  1.5,
+		"general.display name":           "Some Name",
+		"general.nested category.blocks": []string{"minecraft:stone", "minecraft:dirt"},
+	}
+	if got := configValues(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if entries[0].Comment != "Enables the mod" || entries[0].Type != "B" {
+		t.Errorf("enabled has comment %q and type %q", entries[0].Comment, entries[0].Type)
+	}
+	if entries[4].Type != "S[]" {
+		t.Errorf("blocks has type %q", entries[4].Type)
+	}
+}
+
+func TestParseCfgConfigErrors(t *testing.T) {
+	tests := []string{
+		"general {\n    B:enabled=true\n",
+		"}\n",
+		"S:list <\n    a\n",
+		"general {\n    not a setting\n}\n",
+	}
+
+	for _, data := range tests {
+		_, err := parseCfgConfig(data)
+		if err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+const testTOMLConfig = `# Server settings
+[general]
+	# Enables the mod
+	enabled = true
+	range = 16 # blocks
+	speed = 1.5
+	name = "Some Name"
+	blocks = ["minecraft:stone", "minecraft:dirt"]
+
+[[general.rules]]
+	ignored = 1
+
+[client.display]
+	scale = 2
+`
+
+func TestParseTOMLConfig(t *testing.T) {
+	entries, err := parseTOMLConfig(testTOMLConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"general.enabled":      true,
+		"general.range":        int64(16),
+		"general.speed":        1.5,
+		"general.name":         "Some Name",
+		"general.blocks":       []interface{}{"minecraft:stone", "minecraft:dirt"},
+		"client.display.scale": int64(2),
+	}
+	if got := configValues(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if entries[0].Comment != "Enables the mod" {
+		t.Errorf("enabled has comment %q", entries[0].Comment)
+	}
+	if entries[2].Comment != "" {
+		t.Errorf("speed has the comment %q from the line before", entries[2].Comment)
+	}
+}
+
+func TestEditConfig(t *testing.T) {
+	dir := filepath.Join(useTempRoot(t), ConfigDirectory)
+	err := os.MkdirAll(filepath.Join(dir, "mod"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "legacy.cfg"), []byte(testCfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "mod", "server.toml"), []byte(testTOMLConfig), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file  string
+		edits map[string]string
+		want  map[string]interface{}
+		// contents is the edited file, checked so everything other than the values is kept.
+		contents string
+	}{
+		{
+			file:  "legacy.cfg",
+			edits: map[string]string{"general.enabled": "false", "general.nested category.blocks": "minecraft:sand"},
+			want: map[string]interface{}{
+				"general.enabled":                false,
+				"general.range":                  16,
+				"general.speed":                  1.5,
+				"general.display name":           "Some Name",
+				"general.nested category.blocks": []string{"minecraft:sand"},
+			},
+			contents: `# Configuration file
+
+~CONFIG_VERSION: 0.1.0
+
+general {
+    # Enables the mod
+    B:enabled=false
+
+    # How far it reaches
+    I:range=16
+    D:speed=1.5
+    S:"display name"=Some Name
+
+    "nested category" {
+        S:blocks <
+            minecraft:sand
+         >
+    }
+
+}
+`,
+		},
+		{
+			file:  "mod/server.toml",
+			edits: map[string]string{"general.range": "32", "general.speed": "2", "general.name": "Quote \" name"},
+			want: map[string]interface{}{
+				"general.enabled":      true,
+				"general.range":        int64(32),
+				"general.speed":        2.0,
+				"general.name":         "Quote \" name",
+				"general.blocks":       []interface{}{"minecraft:stone", "minecraft:dirt"},
+				"client.display.scale": int64(2),
+			},
+			contents: `# Server settings
+[general]
+	# Enables the mod
+	enabled = true
+	range = 32 # blocks
+	speed = 2.0
+	name = "Quote \" name"
+	blocks = ["minecraft:stone", "minecraft:dirt"]
+
+[[general.rules]]
+	ignored = 1
+
+[client.display]
+	scale = 2
+`,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := EditConfig(test.file, test.edits)
+		if err != nil {
+			t.Errorf("%s: %s", test.file, err)
+			continue
+		}
+		if len(result.Changed) != len(test.edits) {
+			t.Errorf("%s: changed %v", test.file, result.Changed)
+		}
+
+		entries, err := ReadConfig(test.file)
+		if err != nil {
+			t.Errorf("%s: %s", test.file, err)
+			continue
+		}
+		if got := configValues(entries); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.file, got, test.want)
+		}
+		contents, _ := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(test.file)))
+		if string(contents) != test.contents {
+			t.Errorf("%s: edited file is\n%s", test.file, contents)
+		}
+	}
+}
+
+func TestEditConfigErrors(t *testing.T) {
+	dir := filepath.Join(useTempRoot(t), ConfigDirectory)
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "server.toml"), []byte(testTOMLConfig), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file  string
+		edits map[string]string
+	}{
+		{"server.toml", map[string]string{"general.missing": "1"}},
+		{"server.toml", map[string]string{"general.enabled": "yes"}},
+		{"server.toml", map[string]string{"general.range": "1.5"}},
+		{"server.toml", map[string]string{"general.name": "two\nlines"}},
+		{"../settings.toml", map[string]string{"a": "1"}},
+		{"server.json", map[string]string{"a": "1"}},
+	}
+
+	for _, test := range tests {
+		_, err := EditConfig(test.file, test.edits)
+		if err == nil {
+			t.Errorf("%s %v: expected an error", test.file, test.edits)
+		}
+	}
+
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, "server.toml"))
+	if string(contents) != testTOMLConfig {
+		t.Errorf("failed edits changed the file to\n%s", contents)
+	}
+}
+
+func TestEditConfigBackups(t *testing.T) {
+	server := useTempRoot(t)
+	dir := filepath.Join(server, ConfigDirectory)
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "server.toml"), []byte(testTOMLConfig), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits in quick succession each keep their own backup.
+	backups := make(map[string]bool)
+	for _, value := range []string{"1", "2", "3"} {
+		result, err := EditConfig("server.toml", map[string]string{"general.range": value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backups[result.Backup] {
+			t.Errorf("backup %s was reused", result.Backup)
+		}
+		backups[result.Backup] = true
+		if _, err := os.Stat(filepath.Join(server, filepath.FromSlash(result.Backup))); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestConfigSetWhileRunning(t *testing.T) {
+	dir := filepath.Join(useTempRoot(t), ConfigDirectory)
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "server.toml"), []byte(testTOMLConfig), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &McRunner{Settings: DefaultSettings(), State: Running}
+
+	// Without a reboot the mods could overwrite the edit as the server stops.
+	command := &Command{Command: "config set server.toml general.range 3"}
+	if _, err := runner.configCommand(command, []string{"set", "server.toml", "general.range", "3"}); err == nil {
+		t.Error("expected config set to be refused while the server is running")
+	}
+	if contents, err := ioutil.ReadFile(filepath.Join(dir, "server.toml")); string(contents) != testTOMLConfig {
+		t.Errorf("server.toml was changed: %q, %v", contents, err)
+	}
+
+	runner.State = NotRunning
+	if _, err := runner.configCommand(command, []string{"set", "server.toml", "general.range", "3"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,263 @@
+package mcrunner
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCurseForgeAPIURL is the CurseForge API used when Settings doesn't name one.
+const DefaultCurseForgeAPIURL = "https://api.curseforge.com"
+
+// curseForgeManifest is the manifest.json at the root of a CurseForge modpack export.
+type curseForgeManifest struct {
+	Minecraft struct {
+		Version    string `json:"version"`
+		ModLoaders []struct {
+			ID      string `json:"id"`
+			Primary bool   `json:"primary"`
+		} `json:"modLoaders"`
+	} `json:"minecraft"`
+	ManifestType string `json:"manifestType"`
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Files        []struct {
+		ProjectID int  `json:"projectID"`
+		FileID    int  `json:"fileID"`
+		Required  bool `json:"required"`
+	} `json:"files"`
+	Overrides string `json:"overrides"`
+}
+
+// curseForgeFile is the CurseForge API response describing a single mod file.
+type curseForgeFile struct {
+	Data struct {
+		ID          int    `json:"id"`
+		FileName    string `json:"fileName"`
+		DownloadURL string `json:"downloadUrl"`
+		Hashes      []struct {
+			Value string `json:"value"`
+			Algo  int    `json:"algo"`
+		} `json:"hashes"`
+	} `json:"data"`
+}
+
+// curseForgeSHA1Algo is the value of curseForgeFile hash algo for SHA1.
+const curseForgeSHA1Algo = 1
+
+// curseForgeAPIURL returns the CurseForge API URL from Settings, or the default.
+func (runner *McRunner) curseForgeAPIURL() string {
+	settings := runner.currentSettings()
+	if settings.CurseForgeAPIURL != "" {
+		return strings.TrimSuffix(settings.CurseForgeAPIURL, "/")
+	}
+	return DefaultCurseForgeAPIURL
+}
+
+// ImportCurseForgePack imports a CurseForge modpack. path may be a modpack export containing
+// manifest.json, a bare manifest.json, or a server pack zip which is extracted as is.
+func (runner *McRunner) ImportCurseForgePack(path string) error {
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Println("ImportCurseForgePack: ReadFile:", err)
+			return err
+		}
+
+		manifest := new(curseForgeManifest)
+		err = json.Unmarshal(bytes, manifest)
+		if err != nil {
+			fmt.Println("ImportCurseForgePack: parsing manifest:", err)
+			return err
+		}
+		return runner.applyCurseForgeManifest(manifest, nil)
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		fmt.Println("ImportCurseForgePack: OpenReader:", err)
+		return err
+	}
+	defer archive.Close()
+
+	manifestFile := findZipFile(&archive.Reader, "manifest.json")
+	if manifestFile == nil {
+		fmt.Println("No manifest.json, importing as a server pack")
+		mcver, loader, loaderver := serverPackVersions(&archive.Reader, runner.currentSettings().Loader)
+		stage, err := newModpackStage()
+		if err != nil {
+			fmt.Println("ImportCurseForgePack: newModpackStage:", err)
+			return err
+		}
+		defer stage.Discard()
+
+		// Server packs are often zipped with everything inside a single folder, which is stripped,
+		// unless that folder is itself part of the server's layout.
+		root := zipRoot(&archive.Reader)
+		switch root {
+		case ModsDirectory + "/", "config/", "libraries/", "world/":
+			root = ""
+		}
+		err = extractZip(&archive.Reader, root, stage.Path)
+		if err != nil {
+			fmt.Println("ImportCurseForgePack: extractZip:", err)
+			return err
+		}
+		err = runner.commitModpack(stage, mcver, loader, loaderver)
+		if err != nil {
+			fmt.Println("ImportCurseForgePack: commitModpack:", err)
+		}
+		return err
+	}
+
+	reader, err := manifestFile.Open()
+	if err != nil {
+		fmt.Println("ImportCurseForgePack: opening manifest:", err)
+		return err
+	}
+	manifest := new(curseForgeManifest)
+	err = json.NewDecoder(reader).Decode(manifest)
+	reader.Close()
+	if err != nil {
+		fmt.Println("ImportCurseForgePack: parsing manifest:", err)
+		return err
+	}
+	return runner.applyCurseForgeManifest(manifest, &archive.Reader)
+}
+
+// applyCurseForgeManifest sets up the versions, mods and overrides described by manifest.
+// archive is the modpack the overrides are read from, or nil if there are none. Mods whose authors
+// disabled third party downloads are taken from the mods directory if they have been put there by
+// hand, otherwise the import fails before anything is downloaded.
+func (runner *McRunner) applyCurseForgeManifest(manifest *curseForgeManifest, archive *zip.Reader) error {
+	fmt.Println(fmt.Sprintf("Importing CurseForge modpack %s %s", manifest.Name, manifest.Version))
+
+	loaderid := ""
+	for _, modloader := range manifest.Minecraft.ModLoaders {
+		if modloader.Primary || loaderid == "" {
+			loaderid = modloader.ID
+		}
+	}
+	// Loader IDs look like "forge-14.23.5.2847" or "fabric-0.14.21".
+	parts := strings.SplitN(loaderid, "-", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("applyCurseForgeManifest: unrecognized mod loader %q", loaderid)
+	}
+
+	_, err := GetLoader(parts[0])
+	if err != nil {
+		return err
+	}
+
+	// Every file is looked up first, so a pack that can't be completed fails before anything is
+	// downloaded. LocalPath is the file's name until the stage is created.
+	var downloads []Download
+	var kept, manual []string
+	for _, file := range manifest.Files {
+		if !file.Required {
+			continue
+		}
+
+		info := new(curseForgeFile)
+		err = runner.curseForgeGet(fmt.Sprintf("/v1/mods/%d/files/%d", file.ProjectID, file.FileID), info)
+		if err != nil {
+			fmt.Println("applyCurseForgeManifest: fetching file info:", err)
+			return err
+		}
+
+		download := Download{LocalPath: filepath.Base(info.Data.FileName), URL: info.Data.DownloadURL}
+		for _, hash := range info.Data.Hashes {
+			if hash.Algo == curseForgeSHA1Algo {
+				download.Checksum = SHA1(hash.Value)
+			}
+		}
+		if download.URL != "" {
+			downloads = append(downloads, download)
+			continue
+		}
+
+		// Authors can disable third party downloads, those files have to be fetched by hand.
+		existing := filepath.Join(McServerPath(), ModsDirectory, download.LocalPath)
+		if info, err := os.Stat(existing); err == nil && info.Size() > 0 && download.Checksum.Verify(existing) == nil {
+			kept = append(kept, existing)
+		} else {
+			manual = append(manual, download.LocalPath)
+		}
+	}
+	if len(manual) > 0 {
+		return fmt.Errorf("%d mods must be downloaded by hand into %s before importing again: %s", len(manual), ModsDirectory, strings.Join(manual, ", "))
+	}
+
+	stage, err := newModpackStage()
+	if err != nil {
+		fmt.Println("applyCurseForgeManifest: newModpackStage:", err)
+		return err
+	}
+	defer stage.Discard()
+
+	if archive != nil {
+		overrides := manifest.Overrides
+		if overrides == "" {
+			overrides = "overrides"
+		}
+		err = extractZip(archive, overrides+"/", stage.Path)
+		if err != nil {
+			fmt.Println("applyCurseForgeManifest: extracting overrides:", err)
+			return err
+		}
+	}
+
+	for _, download := range downloads {
+		download.LocalPath = filepath.Join(stage.Path, ModsDirectory, download.LocalPath)
+		err = runner.Download(download)
+		if err != nil {
+			fmt.Println("applyCurseForgeManifest: Download:", err)
+			return err
+		}
+	}
+	for _, existing := range kept {
+		err = linkOrCopy(existing, filepath.Join(stage.Path, ModsDirectory, filepath.Base(existing)))
+		if err != nil {
+			fmt.Println("applyCurseForgeManifest: linkOrCopy:", err)
+			return err
+		}
+	}
+
+	err = runner.commitModpack(stage, manifest.Minecraft.Version, parts[0], parts[1])
+	if err != nil {
+		fmt.Println("applyCurseForgeManifest: commitModpack:", err)
+	}
+	return err
+}
+
+// curseForgeGet GETs path from the CurseForge API through the mirrors and decodes the response into v.
+func (runner *McRunner) curseForgeGet(path string, v interface{}) error {
+	settings := runner.currentSettings()
+	if settings.Offline {
+		return fmt.Errorf("%s: the CurseForge API can't be used while offline", path)
+	}
+	request, err := http.NewRequest("GET", runner.mirrorURL(runner.curseForgeAPIURL()+path), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if settings.CurseForgeAPIKey != "" {
+		request.Header.Set("x-api-key", settings.CurseForgeAPIKey)
+	}
+
+	response, err := downloadClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return &HTTPStatusError{URL: request.URL.String(), StatusCode: response.StatusCode, Status: response.Status}
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
@@ -0,0 +1,213 @@
+package mcrunner
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeZip writes a zip of files, keyed by their names in the archive, to path.
+func writeZip(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	for name, contents := range files {
+		writer, err := archive.Create(name)
+		if err == nil {
+			_, err = writer.Write([]byte(contents))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = archive.Close()
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listFiles returns the paths of the files under dir, relative to it with forward slashes.
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relpath, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(relpath))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+const testCurseForgeManifest = `{
+	"minecraft": {"version": "1.12.2", "modLoaders": [{"id": "forge-14.23.5.2860", "primary": true}]},
+	"manifestType": "minecraftModpack",
+	"name": "Test Pack",
+	"version": "1.0",
+	"files": [
+		{"projectID": 10, "fileID": 100, "required": true},
+		{"projectID": 20, "fileID": 200, "required": false}
+	],
+	"overrides": "overrides"
+}`
+
+// serveCurseForge serves the CurseForge API for the files in testCurseForgeManifest. Project 10's
+// file has downloadURL, or no download URL if it's empty.
+func serveCurseForge(t *testing.T, downloadURL string) *McRunner {
+	server := serveFiles(t, map[string]string{
+		"/v1/mods/10/files/100": `{"data": {"id": 100, "fileName": "first-mod-1.0.jar", "downloadUrl": "` + downloadURL + `",
+			"hashes": [{"value": "ignored", "algo": 2}, {"value": "` + sha1Hex("first mod") + `", "algo": 1}]}}`,
+		"/v1/mods/20/files/200":    `{"data": {"id": 200, "fileName": "optional-mod.jar", "downloadUrl": "{{base}}/files/optional-mod.jar"}}`,
+		"/files/first-mod-1.0.jar": "first mod",
+		"/files/optional-mod.jar":  "optional mod",
+	})
+	return &McRunner{Settings: Settings{CurseForgeAPIURL: server.URL + "/", InstallerVersion: "0.9.0", LaunchWrapperVersion: "1.5"}}
+}
+
+func TestImportCurseForgePack(t *testing.T) {
+	dir := useTempRoot(t)
+	runner := serveCurseForge(t, "{{base}}/files/first-mod-1.0.jar")
+	err := os.MkdirAll(filepath.Join(dir, ModsDirectory), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, ModsDirectory, "previous-pack.jar"), []byte("old"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pack := filepath.Join(dir, "pack.zip")
+	writeZip(t, pack, map[string]string{
+		"manifest.json":              testCurseForgeManifest,
+		"modlist.html":               "<ul></ul>",
+		"overrides/config/mod.cfg":   "B:enabled=true\n",
+		"overrides/mods/bundled.jar": "bundled",
+	})
+	err = runner.ImportModpack(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, BackupDirectory, "mods-*"))
+	if len(backups) != 1 {
+		t.Fatalf("previous mods backed up to %v", backups)
+	}
+	want := []string{
+		BackupDirectory + "/" + filepath.Base(backups[0]) + "/previous-pack.jar",
+		"config/mod.cfg",
+		"mods/bundled.jar",
+		"mods/first-mod-1.0.jar",
+		"pack.zip",
+		SettingsFile,
+	}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %v, want %v", got, want)
+	}
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, ModsDirectory, "first-mod-1.0.jar"))
+	if string(contents) != "first mod" {
+		t.Errorf("downloaded mod is %q", contents)
+	}
+
+	settings := runner.Settings
+	if settings.MinecraftVersion != "1.12.2" || settings.Loader != "forge" || settings.LoaderVersion != "14.23.5.2860" {
+		t.Errorf("versions set to Minecraft %s with %s %s", settings.MinecraftVersion, settings.Loader, settings.LoaderVersion)
+	}
+	if settings.LaunchWrapperVersion != "1.12" || settings.InstallerVersion != "" {
+		t.Errorf("launchwrapper %q and installer %q weren't reset for the pack", settings.LaunchWrapperVersion, settings.InstallerVersion)
+	}
+	saved, err := loadSettingsFile()
+	if err != nil || saved.LoaderVersion != "14.23.5.2860" {
+		t.Errorf("saved LoaderVersion %q, %v", saved.LoaderVersion, err)
+	}
+}
+
+func TestImportCurseForgePackManualDownloads(t *testing.T) {
+	dir := useTempRoot(t)
+	runner := serveCurseForge(t, "")
+	err := os.MkdirAll(filepath.Join(dir, ModsDirectory), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, ModsDirectory, "previous-pack.jar"), []byte("old"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := filepath.Join(dir, "manifest.json")
+	err = ioutil.WriteFile(manifest, []byte(testCurseForgeManifest), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.ImportModpack(manifest)
+	if err == nil || !strings.Contains(err.Error(), "first-mod-1.0.jar") {
+		t.Errorf("expected first-mod-1.0.jar to need downloading by hand, got %v", err)
+	}
+	want := []string{"manifest.json", "mods/previous-pack.jar"}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("failed import left %v, want %v", got, want)
+	}
+	if runner.Settings.MinecraftVersion != "" {
+		t.Errorf("failed import set MinecraftVersion %s", runner.Settings.MinecraftVersion)
+	}
+
+	// Importing again once the mod has been downloaded by hand uses it.
+	err = ioutil.WriteFile(filepath.Join(dir, ModsDirectory, "first-mod-1.0.jar"), []byte("first mod"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.ImportModpack(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, BackupDirectory, "mods-*"))
+	if len(backups) != 1 {
+		t.Fatalf("previous mods backed up to %v", backups)
+	}
+	backup := BackupDirectory + "/" + filepath.Base(backups[0])
+	want = []string{backup + "/first-mod-1.0.jar", backup + "/previous-pack.jar", "manifest.json", "mods/first-mod-1.0.jar", SettingsFile}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %v, want %v", got, want)
+	}
+}
+
+func TestImportCurseForgeServerPack(t *testing.T) {
+	dir := useTempRoot(t)
+	runner := &McRunner{Settings: Settings{Loader: "fabric", MinecraftVersion: "1.20.1", LoaderVersion: "0.15.0"}}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pack := filepath.Join(dir, "server.zip")
+	writeZip(t, pack, map[string]string{
+		"Pack Server/forge-1.16.5-36.2.39-installer.jar": "installer",
+		"Pack Server/mods/mod.jar":                       "mod",
+		"Pack Server/config/mod.toml":                    "enabled = true\n",
+	})
+	err = runner.ImportModpack(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"config/mod.toml", "forge-1.16.5-36.2.39-installer.jar", "mods/mod.jar", "server.zip", SettingsFile}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %v, want %v", got, want)
+	}
+	settings := runner.Settings
+	if settings.MinecraftVersion != "1.16.5" || settings.Loader != "forge" || settings.LoaderVersion != "36.2.39" {
+		t.Errorf("versions set to Minecraft %s with %s %s", settings.MinecraftVersion, settings.Loader, settings.LoaderVersion)
+	}
+}
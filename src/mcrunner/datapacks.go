@@ -0,0 +1,311 @@
+package mcrunner
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DatapacksDirectory name of the datapacks directory inside the world directory.
+	DatapacksDirectory = "datapacks"
+	// ConsoleTimeout is how long to wait for the server to respond to a console command.
+	ConsoleTimeout = 10 * time.Second
+)
+
+// DatapackInfo describes a datapack in the world's datapacks directory, or one built into the
+// server or a mod.
+type DatapackInfo struct {
+	// Name is the file name in the datapacks directory, or the pack ID of built in packs.
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Format      int    `json:"format,omitempty"`
+	// State is "enabled" or "available" as reported by "datapack list", empty if the server isn't running.
+	State string `json:"state,omitempty"`
+}
+
+// packMcmeta is the pack.mcmeta at the root of a datapack.
+type packMcmeta struct {
+	Pack *struct {
+		PackFormat  int             `json:"pack_format"`
+		Description json.RawMessage `json:"description"`
+	} `json:"pack"`
+}
+
+var (
+	// datapackListExp matches the lines of "datapack list" output, which vary between
+	// "data packs" and "data pack(s)" across versions.
+	datapackListExp = regexp.MustCompile("There are (?:no more|no|[0-9]+) data pack\\S* (enabled|available)(?:: (.*))?")
+	// datapackIDExp matches a pack in a "datapack list" line, e.g. "[file/example.zip (world)]".
+	datapackIDExp = regexp.MustCompile("\\[([^\\]]+?)(?: \\([^)]*\\))?\\]")
+)
+
+// worldPath returns the world directory.
+func (runner *McRunner) worldPath() string {
+	return filepath.Join(McServerPath(), runner.worldName())
+}
+
+// worldName returns the name of the world directory inside the mcserver directory, set by
+// level-name in Settings.Properties or server.properties.
+func (runner *McRunner) worldName() string {
+	level := runner.currentSettings().Properties["level-name"]
+	if level == "" {
+		if properties, err := ReadProperties(PropertiesPath()); err == nil {
+			level, _ = properties.Get("level-name")
+		}
+	}
+	if level == "" {
+		level = WorldDirectory
+	}
+	return level
+}
+
+// datapacksPath returns the datapacks directory of the world.
+func (runner *McRunner) datapacksPath() string {
+	return filepath.Join(runner.worldPath(), DatapacksDirectory)
+}
+
+// parsePackMcmeta reads the format and description from the contents of a pack.mcmeta.
+func parsePackMcmeta(name string, contents []byte) (DatapackInfo, error) {
+	info := DatapackInfo{Name: name}
+	mcmeta := new(packMcmeta)
+	err := json.Unmarshal(contents, mcmeta)
+	if err != nil {
+		return info, fmt.Errorf("%s: pack.mcmeta: %s", name, err)
+	}
+	if mcmeta.Pack == nil || mcmeta.Pack.PackFormat <= 0 {
+		return info, fmt.Errorf("%s: pack.mcmeta has no pack_format", name)
+	}
+
+	info.Format = mcmeta.Pack.PackFormat
+	// The description is a plain string or a text component, which is kept as JSON.
+	if json.Unmarshal(mcmeta.Pack.Description, &info.Description) != nil {
+		info.Description = string(mcmeta.Pack.Description)
+	}
+	return info, nil
+}
+
+// ReadDatapack reads the pack.mcmeta of the datapack directory or zip at path.
+func ReadDatapack(path string) (DatapackInfo, error) {
+	name := filepath.Base(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return DatapackInfo{Name: name}, err
+	}
+
+	if info.IsDir() {
+		contents, err := ioutil.ReadFile(filepath.Join(path, "pack.mcmeta"))
+		if err != nil {
+			return DatapackInfo{Name: name}, err
+		}
+		return parsePackMcmeta(name, contents)
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return DatapackInfo{Name: name}, err
+	}
+	defer archive.Close()
+
+	contents := readZipEntry(&archive.Reader, "pack.mcmeta")
+	if contents == nil {
+		return DatapackInfo{Name: name}, fmt.Errorf("%s has no pack.mcmeta", name)
+	}
+	return parsePackMcmeta(name, contents)
+}
+
+// datapackStates runs "datapack list" and returns the state of each pack by its ID.
+func (runner *McRunner) datapackStates() (map[string]string, error) {
+	states := make(map[string]string)
+	seen := make(map[string]bool)
+	err := runner.executeAndWait("datapack list", ConsoleTimeout, func(line string) bool {
+		match := datapackListExp.FindStringSubmatch(line)
+		if match == nil {
+			return false
+		}
+		for _, id := range datapackIDExp.FindAllStringSubmatch(match[2], -1) {
+			states[id[1]] = match[1]
+		}
+		seen[match[1]] = true
+		return seen["enabled"] && seen["available"]
+	})
+	return states, err
+}
+
+// datapackID returns the pack ID the server knows the named pack by.
+func (runner *McRunner) datapackID(name string) string {
+	if _, err := os.Stat(filepath.Join(runner.datapacksPath(), name)); err == nil {
+		return "file/" + name
+	}
+	return name
+}
+
+// ListDatapacks returns the datapacks in the world's datapacks directory. While the server is
+// running, their states and the built in packs are included.
+func (runner *McRunner) ListDatapacks() ([]DatapackInfo, error) {
+	packs := []DatapackInfo{}
+	files, err := ioutil.ReadDir(runner.datapacksPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		if !file.IsDir() && !strings.HasSuffix(strings.ToLower(file.Name()), ".zip") {
+			continue
+		}
+		info, err := ReadDatapack(filepath.Join(runner.datapacksPath(), file.Name()))
+		if err != nil {
+			fmt.Println("ListDatapacks:", err)
+		}
+		packs = append(packs, info)
+	}
+
+	if runner.state() == Running {
+		states, err := runner.datapackStates()
+		if err != nil {
+			return nil, err
+		}
+		for i := range packs {
+			packs[i].State = states["file/"+packs[i].Name]
+			delete(states, "file/"+packs[i].Name)
+		}
+		for id, state := range states {
+			packs = append(packs, DatapackInfo{Name: id, State: state})
+		}
+	}
+
+	sort.Slice(packs, func(i, j int) bool { return strings.ToLower(packs[i].Name) < strings.ToLower(packs[j].Name) })
+	return packs, nil
+}
+
+// SetDatapackEnabled enables or disables a datapack through the console and waits for
+// "datapack list" to confirm it. The server must be running.
+func (runner *McRunner) SetDatapackEnabled(name string, enabled bool) error {
+	if runner.state() != Running {
+		return fmt.Errorf("the server must be running to enable or disable datapacks")
+	}
+
+	id := runner.datapackID(name)
+	action, want := "disable", "available"
+	if enabled {
+		action, want = "enable", "enabled"
+	}
+	runner.executeCommand(fmt.Sprintf("datapack %s \"%s\"", action, id))
+	return runner.awaitDatapackState(id, want)
+}
+
+// awaitDatapackState polls "datapack list" until the pack with id is in state.
+func (runner *McRunner) awaitDatapackState(id, state string) error {
+	deadline := time.Now().Add(ConsoleTimeout)
+	for {
+		states, err := runner.datapackStates()
+		if err != nil {
+			return err
+		}
+		if states[id] == state {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if states[id] == "" {
+				return fmt.Errorf("the server doesn't know datapack %s", id)
+			}
+			return fmt.Errorf("datapack %s is %s instead of %s", id, states[id], state)
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// InstallDatapack places an uploaded datapack zip in the world's datapacks directory. Zips with
+// everything in a single folder are extracted, since the server only reads pack.mcmeta at the root.
+// While the server is running the datapacks are reloaded and the new pack is enabled.
+func (runner *McRunner) InstallDatapack(name string, contents []byte) (DatapackInfo, error) {
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, "/\\") || !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		return DatapackInfo{}, fmt.Errorf("%q is not a zip file name", name)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return DatapackInfo{}, fmt.Errorf("%s is not a zip: %s", name, err)
+	}
+
+	err = os.MkdirAll(runner.datapacksPath(), 0755)
+	if err != nil {
+		return DatapackInfo{}, err
+	}
+
+	var info DatapackInfo
+	if mcmeta := readZipEntry(archive, "pack.mcmeta"); mcmeta != nil {
+		info, err = parsePackMcmeta(name, mcmeta)
+		if err != nil {
+			return info, err
+		}
+		localpath := filepath.Join(runner.datapacksPath(), name)
+		err = ioutil.WriteFile(localpath+partialSuffix, contents, 0644)
+		if err == nil {
+			err = os.Rename(localpath+partialSuffix, localpath)
+		}
+	} else if root := zipRoot(archive); root != "" && readZipEntry(archive, root+"pack.mcmeta") != nil {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+		info, err = parsePackMcmeta(name, readZipEntry(archive, root+"pack.mcmeta"))
+		if err != nil {
+			return info, err
+		}
+		dest := filepath.Join(runner.datapacksPath(), name)
+		os.RemoveAll(dest)
+		err = extractZip(archive, root, dest)
+	} else {
+		return DatapackInfo{}, fmt.Errorf("%s has no pack.mcmeta, it isn't a datapack", name)
+	}
+	if err != nil {
+		return info, err
+	}
+
+	if runner.state() == Running {
+		// New packs are picked up, and normally enabled, by a reload.
+		runner.executeCommand("reload")
+		id := "file/" + info.Name
+		err = runner.awaitDatapackState(id, "enabled")
+		if err != nil {
+			err = runner.SetDatapackEnabled(info.Name, true)
+		}
+		if err != nil {
+			return info, err
+		}
+		info.State = "enabled"
+	}
+	return info, nil
+}
+
+// datapacksCommand handles "datapacks list", "datapacks install <file name>" with the zip as the
+// command's Data, "datapacks enable <name>" and "datapacks disable <name>".
+func (runner *McRunner) datapacksCommand(command *Command, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: datapacks list|install|enable|disable")
+	}
+	if args[0] == "list" {
+		return runner.ListDatapacks()
+	}
+	if len(args) != 2 {
+		return nil, fmt.Errorf("usage: datapacks %s <name>", args[0])
+	}
+
+	switch args[0] {
+	case "install":
+		if len(command.Data) == 0 {
+			return nil, fmt.Errorf("datapacks install needs the zip uploaded with the command")
+		}
+		return runner.InstallDatapack(args[1], command.Data)
+	case "enable":
+		return nil, runner.SetDatapackEnabled(args[1], true)
+	case "disable":
+		return nil, runner.SetDatapackEnabled(args[1], false)
+	}
+	return nil, fmt.Errorf("unknown datapacks command %q", args[0])
+}
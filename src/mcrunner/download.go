@@ -0,0 +1,385 @@
+package mcrunner
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DownloadRetries is how many times a failed download is retried before giving up.
+	DownloadRetries = 3
+	// DownloadRetryDelay is the delay before the first retry, doubled for each retry after that.
+	DownloadRetryDelay = 2 * time.Second
+	// DownloadTimeout is the longest a single download attempt may take, body included.
+	DownloadTimeout = 30 * time.Minute
+	// DownloadIdleTimeout is the longest a download may go without receiving any data.
+	DownloadIdleTimeout = 60 * time.Second
+	// NoRetries is the Download.Retries value for a download that isn't retried.
+	NoRetries = -1
+	// partialSuffix is appended to the local path while a download is in progress.
+	partialSuffix = ".part"
+	// resumeSuffix is appended to the partial file's path for the resumeInfo that lets it be resumed.
+	resumeSuffix = ".json"
+)
+
+// downloadClient times out connections that stall before the response, and whole attempts that
+// take longer than DownloadTimeout, so a dead mirror can't hang an install.
+var downloadClient = &http.Client{
+	Timeout: DownloadTimeout,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// Checksum is the expected hash of a downloaded file. The zero value skips verification.
+type Checksum struct {
+	// Algorithm is one of "sha1", "sha256" or "sha512".
+	Algorithm string
+	// Sum is the hex encoded hash.
+	Sum string
+}
+
+// SHA1 returns a Checksum for a hex encoded SHA1.
+func SHA1(sum string) Checksum {
+	return Checksum{Algorithm: "sha1", Sum: sum}
+}
+
+// SHA256 returns a Checksum for a hex encoded SHA256.
+func SHA256(sum string) Checksum {
+	return Checksum{Algorithm: "sha256", Sum: sum}
+}
+
+// SHA512 returns a Checksum for a hex encoded SHA512.
+func SHA512(sum string) Checksum {
+	return Checksum{Algorithm: "sha512", Sum: sum}
+}
+
+// newHash returns a new hash.Hash for the Checksum's algorithm.
+func (checksum Checksum) newHash() (hash.Hash, error) {
+	switch strings.ToLower(checksum.Algorithm) {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", checksum.Algorithm)
+}
+
+// Verify returns an error if the file at path doesn't match the Checksum.
+func (checksum Checksum) Verify(path string) error {
+	if checksum.Sum == "" {
+		return nil
+	}
+
+	hash, err := checksum.newHash()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, checksum.Sum) {
+		return fmt.Errorf("%s: %s %s does not match expected %s", filepath.Base(strings.TrimSuffix(path, partialSuffix)), checksum.Algorithm, actual, checksum.Sum)
+	}
+	return nil
+}
+
+// HTTPStatusError is returned when a download responds with an unexpected status code.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (err *HTTPStatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", err.URL, err.Status)
+}
+
+// retryable returns true if the request may succeed if it is tried again.
+func (err *HTTPStatusError) retryable() bool {
+	return err.StatusCode >= 500 || err.StatusCode == http.StatusRequestTimeout || err.StatusCode == http.StatusTooManyRequests
+}
+
+// Download describes a single file to download.
+// The file is written to LocalPath + ".part" and only renamed into place once it is complete and
+// matches Checksum, so LocalPath either doesn't exist or holds a complete file.
+type Download struct {
+	LocalPath string
+	URL       string
+	Checksum  Checksum
+	// ReturnIfExists skips the download if LocalPath already exists and matches Checksum.
+	ReturnIfExists bool
+	// Retries overrides DownloadRetries when non-zero, NoRetries disables retrying.
+	Retries int
+	// Progress, if set, is called as data arrives with the bytes downloaded so far and the
+	// total size, which is 0 if the server didn't say.
+	Progress func(bytes, total int64)
+}
+
+// progressWriter reports the running total of bytes written to it.
+type progressWriter struct {
+	written  int64
+	total    int64
+	progress func(bytes, total int64)
+}
+
+func (writer *progressWriter) Write(p []byte) (int, error) {
+	writer.written += int64(len(p))
+	writer.progress(writer.written, writer.total)
+	return len(p), nil
+}
+
+// idleTimeoutReader pushes back timer every time data is read, so it only fires once the body has
+// stalled for timeout.
+type idleTimeoutReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (reader *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if n > 0 {
+		reader.timer.Reset(reader.timeout)
+	}
+	return n, err
+}
+
+// resumeInfo identifies the file a partial download without a checksum belongs to, so it is only
+// resumed if the server still has the same file.
+type resumeInfo struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastmodified,omitempty"`
+}
+
+// validator returns the If-Range value for the partial download, or "" if it can't be resumed safely.
+func (info resumeInfo) validator() string {
+	// Weak ETags can't be used with If-Range.
+	if info.ETag != "" && !strings.HasPrefix(info.ETag, "W/") {
+		return info.ETag
+	}
+	return info.LastModified
+}
+
+// readResumeInfo reads the resumeInfo saved next to partpath.
+func readResumeInfo(partpath string) (resumeInfo, error) {
+	var info resumeInfo
+	data, err := ioutil.ReadFile(partpath + resumeSuffix)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// writeResumeInfo saves the resumeInfo for partpath from the response that started it.
+func writeResumeInfo(partpath, url string, response *http.Response) error {
+	info := resumeInfo{URL: url, ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+	if info.validator() == "" {
+		os.Remove(partpath + resumeSuffix)
+		return nil
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(partpath+resumeSuffix, data, 0644)
+}
+
+// removePartial deletes the partial file and its resumeInfo.
+func removePartial(partpath string) {
+	os.Remove(partpath)
+	os.Remove(partpath + resumeSuffix)
+}
+
+// DownloadFile downloads netpath to localpath without verifying a checksum.
+func DownloadFile(localpath, netpath string, returnIfExists bool) error {
+	download := Download{LocalPath: localpath, URL: netpath, ReturnIfExists: returnIfExists}
+	return download.Run()
+}
+
+// Run performs the download, resuming a previous partial download and retrying on transient failures.
+func (download *Download) Run() error {
+	info, err := os.Stat(download.LocalPath)
+	if err == nil && download.ReturnIfExists && info.Size() > 0 {
+		err = download.Checksum.Verify(download.LocalPath)
+		if err == nil {
+			return nil
+		}
+		fmt.Println("Download: existing file is corrupt, downloading again:", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(download.LocalPath), 0755)
+	if err != nil {
+		fmt.Println("Download: MkdirAll:", err)
+		return err
+	}
+
+	retries := download.Retries
+	if retries == 0 {
+		retries = DownloadRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+
+	delay := DownloadRetryDelay
+	for attempt := 0; ; attempt++ {
+		err = download.attempt()
+		if err == nil {
+			return nil
+		}
+
+		statusErr, ok := err.(*HTTPStatusError)
+		if attempt >= retries || (ok && !statusErr.retryable()) {
+			fmt.Println("Download:", err)
+			return err
+		}
+
+		fmt.Println(fmt.Sprintf("Download: %s, retrying in %s", err, delay))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// attempt makes a single attempt at the download, resuming from the partial file if there is one.
+// A partial file is only resumed if the result can be checked: either Checksum is set, or the
+// server still reports the ETag or Last-Modified it had when the partial file was started.
+func (download *Download) attempt() error {
+	partpath := download.LocalPath + partialSuffix
+
+	var offset int64
+	info, err := os.Stat(partpath)
+	if err == nil {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequest("GET", download.URL, nil)
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	if offset > 0 {
+		resumable := download.Checksum.Sum != ""
+		if !resumable {
+			resume, err := readResumeInfo(partpath)
+			if err == nil && resume.URL == download.URL && resume.validator() != "" {
+				// The server sends the whole file instead if it has changed since.
+				request.Header.Set("If-Range", resume.validator())
+				resumable = true
+			}
+		}
+		if resumable {
+			request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		} else {
+			removePartial(partpath)
+			offset = 0
+		}
+	}
+
+	response, err := downloadClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch response.StatusCode {
+	case http.StatusOK:
+		// Either a fresh download or the server ignored the Range header, start over.
+		flags |= os.O_TRUNC
+		offset = 0
+		err = writeResumeInfo(partpath, download.URL, response)
+		if err != nil {
+			return err
+		}
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete, or isn't a prefix of the file any more. Without a
+		// checksum there's no telling which, so start over.
+		if download.Checksum.Sum != "" && download.finish(partpath) == nil {
+			return nil
+		}
+		removePartial(partpath)
+		return fmt.Errorf("GET %s: partial download could not be resumed", download.URL)
+	default:
+		return &HTTPStatusError{URL: download.URL, StatusCode: response.StatusCode, Status: response.Status}
+	}
+
+	partfile, err := os.OpenFile(partpath, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	// A body that stops sending data cancels the request, rather than holding the install up until
+	// DownloadTimeout.
+	idle := time.AfterFunc(DownloadIdleTimeout, cancel)
+	defer idle.Stop()
+	var body io.Reader = &idleTimeoutReader{reader: response.Body, timer: idle, timeout: DownloadIdleTimeout}
+	if download.Progress != nil {
+		var total int64
+		if response.ContentLength >= 0 {
+			total = offset + response.ContentLength
+		}
+		body = io.TeeReader(body, &progressWriter{written: offset, total: total, progress: download.Progress})
+	}
+
+	_, err = io.Copy(partfile, body)
+	closeErr := partfile.Close()
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("GET %s: no data received for %s", download.URL, DownloadIdleTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return download.finish(partpath)
+}
+
+// finish verifies the completed partial file and renames it into place.
+func (download *Download) finish(partpath string) error {
+	err := download.Checksum.Verify(partpath)
+	if err != nil {
+		// A corrupt file can't be resumed, the next attempt starts from scratch.
+		removePartial(partpath)
+		return err
+	}
+	os.Remove(partpath + resumeSuffix)
+	return os.Rename(partpath, download.LocalPath)
+}
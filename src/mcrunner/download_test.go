@@ -0,0 +1,124 @@
+package mcrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDownload is the file served by serveDownload.
+var testDownload = strings.Repeat("downloaded file contents ", 1000)
+
+// serveDownload serves testDownload with Range and If-Range support, recording the Range header of
+// each request in ranges if it isn't nil.
+func serveDownload(t *testing.T, etag string, ranges *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ranges != nil {
+			*ranges = append(*ranges, r.Header.Get("Range"))
+		}
+		if r.URL.Path != "/file.jar" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file.jar", time.Time{}, bytes.NewReader([]byte(testDownload)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadResume(t *testing.T) {
+	half := len(testDownload) / 2
+	tests := []struct {
+		name     string
+		checksum Checksum
+		// resume is the resumeInfo saved with the partial file, or "" for none.
+		resume string
+		// ranged is whether the partial file is offered to the server to continue, which it only
+		// does if the If-Range ETag still matches.
+		ranged bool
+	}{
+		{name: "checksum", checksum: SHA1(sha1Hex(testDownload)), ranged: true},
+		{name: "matching etag", resume: `{"url": "{{url}}", "etag": "\"v1\""}`, ranged: true},
+		{name: "changed etag", resume: `{"url": "{{url}}", "etag": "\"v0\""}`, ranged: true},
+		{name: "no checksum or etag"},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "mcrunner")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		var ranges []string
+		server := serveDownload(t, "\"v1\"", &ranges)
+		url := server.URL + "/file.jar"
+
+		localpath := filepath.Join(dir, "file.jar")
+		err = ioutil.WriteFile(localpath+partialSuffix, []byte(testDownload[:half]), 0644)
+		if err == nil && test.resume != "" {
+			err = ioutil.WriteFile(localpath+partialSuffix+resumeSuffix, []byte(strings.Replace(test.resume, "{{url}}", url, -1)), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		download := Download{LocalPath: localpath, URL: url, Checksum: test.checksum, Retries: NoRetries}
+		err = download.Run()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		contents, _ := ioutil.ReadFile(localpath)
+		if string(contents) != testDownload {
+			t.Errorf("%s: downloaded %d bytes, want %d", test.name, len(contents), len(testDownload))
+		}
+		if ranged := len(ranges) == 1 && ranges[0] != ""; ranged != test.ranged {
+			t.Errorf("%s: requested ranges %q", test.name, ranges)
+		}
+		if files := listFiles(t, dir); len(files) != 1 {
+			t.Errorf("%s: left %v behind", test.name, files)
+		}
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	dir := useTempRoot(t)
+	var ranges []string
+	server := serveDownload(t, "\"v1\"", &ranges)
+
+	tests := []struct {
+		name     string
+		download Download
+	}{
+		{"checksum mismatch", Download{URL: server.URL + "/file.jar", Checksum: SHA1(sha1Hex("something else"))}},
+		{"not found", Download{URL: server.URL + "/missing.jar", Retries: 2}},
+	}
+
+	for _, test := range tests {
+		ranges = nil
+		test.download.LocalPath = filepath.Join(dir, "file.jar")
+		if test.download.Retries == 0 {
+			test.download.Retries = NoRetries
+		}
+		err := test.download.Run()
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		// Neither is worth retrying: the checksum test has retries disabled and 404s aren't retried.
+		if len(ranges) != 1 {
+			t.Errorf("%s: made %d requests", test.name, len(ranges))
+		}
+		if _, err := os.Stat(dir); err == nil {
+			if files := listFiles(t, dir); len(files) != 0 {
+				t.Errorf("%s: left %v behind", test.name, files)
+			}
+		}
+	}
+}
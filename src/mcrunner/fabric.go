@@ -0,0 +1,151 @@
+package mcrunner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	// FabricServerJar name of the Fabric server launcher jar.
+	FabricServerJar = "fabric-server-launch.jar"
+	// DefaultFabricInstallerVersion is the Fabric installer used when Settings doesn't name one.
+	DefaultFabricInstallerVersion = "1.0.1"
+	// QuiltServerJar name of the Quilt server launcher jar.
+	QuiltServerJar = "quilt-server-launch.jar"
+	// QuiltInstallerJar name of the Quilt installer jar while it is being run.
+	QuiltInstallerJar = "quilt-installer.jar"
+	// DefaultQuiltInstallerVersion is the Quilt installer used when Settings doesn't name one.
+	DefaultQuiltInstallerVersion = "0.9.2"
+)
+
+// FabricLoader installs Fabric through the server launcher jar published by Fabric's meta service.
+// The launcher fetches the vanilla server and libraries itself on first launch.
+type FabricLoader struct{}
+
+// Name returns "fabric".
+func (FabricLoader) Name() string {
+	return "fabric"
+}
+
+// Install downloads the Fabric server launcher for the versions in Settings.
+func (FabricLoader) Install(runner *McRunner) error {
+	settings := runner.currentSettings()
+	installerver := settings.InstallerVersion
+	if installerver == "" {
+		installerver = DefaultFabricInstallerVersion
+	}
+
+	jarpath := filepath.Join(McServerPath(), FabricServerJar)
+	netpath := fmt.Sprintf("https://meta.fabricmc.net/v2/versions/loader/%s/%s/%s/server/jar", settings.MinecraftVersion, settings.LoaderVersion, installerver)
+	err := runner.downloadFile(jarpath, netpath, false)
+	if err != nil {
+		fmt.Println("FabricLoader.Install: DownloadFile:", err)
+		return err
+	}
+	return nil
+}
+
+// LaunchTarget returns the Fabric server launcher jar.
+func (FabricLoader) LaunchTarget(mcver, loaderver string) string {
+	return FabricServerJar
+}
+
+// LaunchArgs runs the Fabric server launcher jar.
+func (FabricLoader) LaunchArgs(mcver, loaderver string) []string {
+	return []string{"-jar", FabricServerJar}
+}
+
+// InstalledFiles returns the launcher jar along with the files it downloads on first launch.
+func (FabricLoader) InstalledFiles(info InstallInfo) []string {
+	return []string{FabricServerJar, "server.jar", ".fabric"}
+}
+
+// TPSCommand returns "", Fabric has no built in TPS command.
+func (FabricLoader) TPSCommand() string {
+	return ""
+}
+
+// ParseTPS returns nil, Fabric has no built in TPS command.
+func (FabricLoader) ParseTPS(line string) map[string]float32 {
+	return nil
+}
+
+// LogPatterns returns the vanilla log patterns, Fabric doesn't change the server's log format.
+func (FabricLoader) LogPatterns() *LogPatterns {
+	return vanillaLogPatterns
+}
+
+// QuiltLoader installs Quilt by running the Quilt installer, which also downloads the vanilla server.
+type QuiltLoader struct{}
+
+// Name returns "quilt".
+func (QuiltLoader) Name() string {
+	return "quilt"
+}
+
+// Install downloads and runs the Quilt installer for the versions in Settings.
+func (QuiltLoader) Install(runner *McRunner) error {
+	settings := runner.currentSettings()
+	installerver := settings.InstallerVersion
+	if installerver == "" {
+		installerver = DefaultQuiltInstallerVersion
+	}
+
+	installerjarpath := filepath.Join(McServerPath(), QuiltInstallerJar)
+	installernetpath := fmt.Sprintf("https://maven.quiltmc.org/repository/release/org/quiltmc/quilt-installer/%s/quilt-installer-%s.jar", installerver, installerver)
+	err := runner.downloadFile(installerjarpath, installernetpath, false)
+	if err != nil {
+		fmt.Println("QuiltLoader.Install: DownloadFile:", err)
+		return err
+	}
+	defer os.Remove(installerjarpath)
+
+	java, err := runner.javaPath()
+	if err != nil {
+		fmt.Println("QuiltLoader.Install: javaPath:", err)
+		return err
+	}
+
+	installcmd := exec.Command(java, "-jar", QuiltInstallerJar, "install", "server", settings.MinecraftVersion, settings.LoaderVersion, "--download-server", "--install-dir=.")
+	installcmd.Dir = McServerPath()
+	runner.setInstallPhase("Running Quilt installer")
+	output, err := installcmd.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(output))
+		fmt.Println("QuiltLoader.Install: Running java:", err)
+		return err
+	}
+	return nil
+}
+
+// LaunchTarget returns the Quilt server launcher jar.
+func (QuiltLoader) LaunchTarget(mcver, loaderver string) string {
+	return QuiltServerJar
+}
+
+// LaunchArgs runs the Quilt server launcher jar.
+func (QuiltLoader) LaunchArgs(mcver, loaderver string) []string {
+	return []string{"-jar", QuiltServerJar}
+}
+
+// InstalledFiles returns the launcher jar, the vanilla jar and the libraries the installer wrote.
+func (QuiltLoader) InstalledFiles(info InstallInfo) []string {
+	return []string{QuiltServerJar, "server.jar", filepath.Join("libraries", "org", "quiltmc")}
+}
+
+// TPSCommand returns "", Quilt has no built in TPS command.
+func (QuiltLoader) TPSCommand() string {
+	return ""
+}
+
+// ParseTPS returns nil, Quilt has no built in TPS command.
+func (QuiltLoader) ParseTPS(line string) map[string]float32 {
+	return nil
+}
+
+// LogPatterns returns the vanilla log patterns, Quilt doesn't change the server's log format.
+func (QuiltLoader) LogPatterns() *LogPatterns {
+	return vanillaLogPatterns
+}
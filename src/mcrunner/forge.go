@@ -0,0 +1,233 @@
+package mcrunner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ForgeGeneration identifies how a given Forge version is installed and launched.
+type ForgeGeneration int
+
+const (
+	// ForgeLegacy is pre-1.13 Forge, a runnable universal jar next to the vanilla server jar.
+	ForgeLegacy ForgeGeneration = 0
+	// ForgeInstaller is 1.13 - 1.16 Forge, installed with --installServer into a runnable jar.
+	ForgeInstaller ForgeGeneration = 1
+	// ForgeArgsFile is 1.17+ Forge, installed with --installServer and launched through an args file.
+	ForgeArgsFile ForgeGeneration = 2
+)
+
+// ForgeInstallerJar name of the Forge installer jar while it is being run.
+const ForgeInstallerJar = "forge-installer.jar"
+
+// forgeLogPatterns matches the output of Forge, which logs the server's messages under DedicatedServer.
+var forgeLogPatterns = &LogPatterns{
+	Message: regexp.MustCompile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: <.*>"),
+	TPS:     regexp.MustCompile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: Dim"),
+	Players: regexp.MustCompile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: " + playersPattern),
+	Done:    regexp.MustCompile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: Done"),
+}
+
+// forgeTPSExp matches the dimension and mean TPS in a line of "forge tps" output.
+var forgeTPSExp = regexp.MustCompile("Dim\\s+([^\\s:]+(?::[^\\s:]+)?).*Mean TPS: ([0-9.]+)")
+
+// CompareVersions compares two dotted version strings numerically, returning -1, 0 or 1.
+// Non-numeric suffixes such as "-pre1" are ignored.
+func CompareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an = leadingInt(as[i])
+		}
+		if i < len(bs) {
+			bn = leadingInt(bs[i])
+		}
+		if an < bn {
+			return -1
+		} else if an > bn {
+			return 1
+		}
+	}
+	return 0
+}
+
+// leadingInt parses the leading digits of s, returning 0 if there are none.
+func leadingInt(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
+// GetForgeGeneration returns the ForgeGeneration used for the given Minecraft version.
+func GetForgeGeneration(mcver string) ForgeGeneration {
+	if CompareVersions(mcver, "1.13") < 0 {
+		return ForgeLegacy
+	}
+	if CompareVersions(mcver, "1.17") < 0 {
+		return ForgeInstaller
+	}
+	return ForgeArgsFile
+}
+
+// ForgeInstallerJarName returns the maven file name of the Forge installer jar.
+func ForgeInstallerJarName(mcver, forgever string) string {
+	return fmt.Sprintf("forge-%s-%s-installer.jar", mcver, forgever)
+}
+
+// forgeLibraryPath returns the path, relative to the mcserver directory, of the Forge library directory.
+func forgeLibraryPath(mcver, forgever string) string {
+	return filepath.Join("libraries", "net", "minecraftforge", "forge", fmt.Sprintf("%s-%s", mcver, forgever))
+}
+
+// forgeArgsFile returns the path, relative to the mcserver directory, of the platform's Forge args file.
+func forgeArgsFile(mcver, forgever string) string {
+	argsfile := "unix_args.txt"
+	if runtime.GOOS == "windows" {
+		argsfile = "win_args.txt"
+	}
+	return filepath.Join(forgeLibraryPath(mcver, forgever), argsfile)
+}
+
+// ForgeLaunchTarget returns the path, relative to the mcserver directory, of the file that exists
+// once Forge is installed and is used to launch the server.
+func ForgeLaunchTarget(mcver, forgever string) string {
+	switch GetForgeGeneration(mcver) {
+	case ForgeInstaller:
+		return fmt.Sprintf("forge-%s-%s.jar", mcver, forgever)
+	case ForgeArgsFile:
+		return forgeArgsFile(mcver, forgever)
+	default:
+		return MinecraftServerJar
+	}
+}
+
+// ForgeLaunchArgs returns the java arguments that launch the server, to be placed after any JVM flags.
+func ForgeLaunchArgs(mcver, forgever string) []string {
+	target := ForgeLaunchTarget(mcver, forgever)
+	if GetForgeGeneration(mcver) == ForgeArgsFile {
+		// Java resolves paths in the args file relative to the working directory.
+		return []string{"@" + filepath.ToSlash(target)}
+	}
+	return []string{"-jar", target}
+}
+
+// runForgeInstaller runs the Forge installer jar with --installServer in the mcserver directory.
+func runForgeInstaller(java, installerjarpath string) error {
+	installcmd := exec.Command(java, "-jar", installerjarpath, "--installServer")
+	installcmd.Dir = McServerPath()
+	output, err := installcmd.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(output))
+		fmt.Println("runForgeInstaller: Running java:", err)
+		return err
+	}
+
+	// The installer leaves its log behind, which is only useful if it failed.
+	os.Remove(installerjarpath + ".log")
+	os.Remove(filepath.Join(McServerPath(), "installer.log"))
+	return nil
+}
+
+// ForgeLoader installs and launches Forge across all of its generations.
+type ForgeLoader struct{}
+
+// Name returns "forge".
+func (ForgeLoader) Name() string {
+	return "forge"
+}
+
+// Install installs Forge, plus the launchwrapper and vanilla jar that legacy Forge expects alongside it.
+func (ForgeLoader) Install(runner *McRunner) error {
+	settings := runner.currentSettings()
+	mcver := settings.MinecraftVersion
+	forgever := settings.LoaderVersion
+	err := runner.InstallForgeJar(mcver, forgever)
+	if err != nil {
+		fmt.Println("ForgeLoader.Install: InstallForgeJar:", err)
+		return err
+	}
+
+	// The installer used by newer Forge versions fetches the vanilla jar and libraries itself.
+	if GetForgeGeneration(mcver) != ForgeLegacy {
+		return nil
+	}
+
+	if settings.LaunchWrapperVersion != "" {
+		err = runner.InstallLaunchWrapper(settings.LaunchWrapperVersion)
+		if err != nil {
+			fmt.Println("ForgeLoader.Install: InstallLaunchWrapper:", err)
+			return err
+		}
+	}
+
+	err = runner.InstallMinecraftServerJar(mcver)
+	if err != nil {
+		fmt.Println("ForgeLoader.Install: InstallMinecraftServerJar:", err)
+		return err
+	}
+	return nil
+}
+
+// LaunchTarget returns ForgeLaunchTarget.
+func (ForgeLoader) LaunchTarget(mcver, forgever string) string {
+	return ForgeLaunchTarget(mcver, forgever)
+}
+
+// LaunchArgs returns ForgeLaunchArgs.
+func (ForgeLoader) LaunchArgs(mcver, forgever string) []string {
+	return ForgeLaunchArgs(mcver, forgever)
+}
+
+// InstalledFiles returns the files written by any generation of Forge install.
+func (ForgeLoader) InstalledFiles(info InstallInfo) []string {
+	files := []string{
+		MinecraftServerJar,
+		MinecraftServerJarName(info.MinecraftVersion),
+		fmt.Sprintf("forge-%s-%s.jar", info.MinecraftVersion, info.LoaderVersion),
+		forgeLibraryPath(info.MinecraftVersion, info.LoaderVersion),
+		"run.sh",
+		"run.bat",
+	}
+	if info.LaunchWrapperVersion != "" {
+		files = append(files, filepath.Join("libraries", launchWrapperPath(info.LaunchWrapperVersion)))
+	}
+	return files
+}
+
+// TPSCommand returns "forge tps".
+func (ForgeLoader) TPSCommand() string {
+	return "forge tps"
+}
+
+// ParseTPS parses a "Dim <dimension> ... Mean TPS: <tps>" line of "forge tps" output. Dimensions are
+// numbers such as "-1" before 1.16 and names such as "minecraft:the_nether" after.
+func (ForgeLoader) ParseTPS(line string) map[string]float32 {
+	match := forgeTPSExp.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	tps, err := strconv.ParseFloat(match[2], 32)
+	if err != nil {
+		return nil
+	}
+
+	m := make(map[string]float32)
+	m[match[1]] = float32(tps)
+	return m
+}
+
+// LogPatterns returns the Forge log patterns.
+func (ForgeLoader) LogPatterns() *LogPatterns {
+	return forgeLogPatterns
+}
@@ -0,0 +1,41 @@
+package mcrunner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestForgeParseTPS(t *testing.T) {
+	tests := []struct {
+		line string
+		want map[string]float32
+	}{
+		{
+			line: "[12:00:00] [Server thread/INFO] [net.minecraft.server.dedicated.DedicatedServer]: Dim  0 : Mean tick time: 1.234 ms. Mean TPS: 20.000",
+			want: map[string]float32{"0": 20},
+		},
+		{
+			line: "[12:00:00] [Server thread/INFO] [net.minecraft.server.dedicated.DedicatedServer]: Dim -1 : Mean tick time: 60.000 ms. Mean TPS: 16.667",
+			want: map[string]float32{"-1": 16.667},
+		},
+		{
+			line: "[12:00:00] [Server thread/INFO] [minecraft/DedicatedServer]: Dim minecraft:overworld (minecraft:overworld): Mean tick time: 0.511 ms. Mean TPS: 20.000",
+			want: map[string]float32{"minecraft:overworld": 20},
+		},
+		{
+			line: "[12:00:00] [Server thread/INFO] [minecraft/DedicatedServer]: Dim minecraft:the_nether (minecraft:the_nether): Mean tick time: 55.000 ms. Mean TPS: 18.182",
+			want: map[string]float32{"minecraft:the_nether": 18.182},
+		},
+		{
+			line: "[12:00:00] [Server thread/INFO] [minecraft/DedicatedServer]: Dimensions loaded",
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		got := ForgeLoader{}.ParseTPS(test.line)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.line, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package mcrunner
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	// Decoders for the formats accepted as a ServerIcon.
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+const (
+	// ServerIconFile name of the server icon inside the mcserver directory.
+	ServerIconFile = "server-icon.png"
+	// ServerIconSize is the width and height Minecraft requires of the server icon.
+	ServerIconSize = 64
+)
+
+// serverFilePath resolves a path from Settings, relative paths being inside the mcserver directory.
+func serverFilePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(McServerPath(), path)
+}
+
+// scaleIcon scales src to fit a ServerIconSize square, averaging the source pixels under each
+// icon pixel. Images that aren't square are centered on a transparent background.
+func scaleIcon(src image.Image) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, ServerIconSize, ServerIconSize))
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() > side {
+		side = bounds.Dy()
+	}
+	if side == 0 {
+		return dst
+	}
+
+	// The square of side pixels the source is centered in, in source coordinates.
+	left := bounds.Min.X - (side-bounds.Dx())/2
+	top := bounds.Min.Y - (side-bounds.Dy())/2
+
+	for y := 0; y < ServerIconSize; y++ {
+		y0 := top + y*side/ServerIconSize
+		y1 := top + (y+1)*side/ServerIconSize
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < ServerIconSize; x++ {
+			x0 := left + x*side/ServerIconSize
+			x1 := left + (x+1)*side/ServerIconSize
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			// Average the premultiplied colors, counting padding as transparent.
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					n++
+					if !(image.Point{X: sx, Y: sy}).In(bounds) {
+						continue
+					}
+					sr, sg, sb, sa := src.At(sx, sy).RGBA()
+					r += uint64(sr)
+					g += uint64(sg)
+					b += uint64(sb)
+					a += uint64(sa)
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// WriteServerIcon scales the image at path to the server icon, replacing any existing icon.
+// PNG, JPEG and GIF images are accepted.
+func WriteServerIcon(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return err
+	}
+
+	iconpath := filepath.Join(McServerPath(), ServerIconFile)
+	out, err := os.Create(iconpath + partialSuffix)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(out, scaleIcon(src))
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(iconpath + partialSuffix)
+		return err
+	}
+	return os.Rename(iconpath+partialSuffix, iconpath)
+}
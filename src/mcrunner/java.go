@@ -0,0 +1,241 @@
+package mcrunner
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// JavaRuntime is an installed JDK or JRE.
+type JavaRuntime struct {
+	// Path is the java executable.
+	Path    string
+	Version string
+	Major   int
+}
+
+// JavaRequirement is the range of Java major versions a server can run on. Max is 0 for no upper bound.
+type JavaRequirement struct {
+	Min int
+	Max int
+}
+
+// Allows returns true if runtime satisfies the requirement.
+func (requirement JavaRequirement) Allows(runtime JavaRuntime) bool {
+	return runtime.Major >= requirement.Min && (requirement.Max == 0 || runtime.Major <= requirement.Max)
+}
+
+func (requirement JavaRequirement) String() string {
+	if requirement.Max == requirement.Min {
+		return fmt.Sprintf("Java %d", requirement.Min)
+	} else if requirement.Max == 0 {
+		return fmt.Sprintf("Java %d or newer", requirement.Min)
+	}
+	return fmt.Sprintf("Java %d to %d", requirement.Min, requirement.Max)
+}
+
+// GetJavaRequirement returns the Java versions the given Minecraft version and loader can run on.
+// The minimum comes from info, the version's entry in the version manifest, when it has one, and
+// otherwise from a table of known versions so the requirement is still known offline.
+func GetJavaRequirement(mcver, loader string, info *VersionInfo) JavaRequirement {
+	var requirement JavaRequirement
+	switch {
+	case info != nil && info.JavaVersion.MajorVersion != 0:
+		requirement.Min = info.JavaVersion.MajorVersion
+	case CompareVersions(mcver, "1.17") < 0:
+		requirement.Min = 8
+	case CompareVersions(mcver, "1.18") < 0:
+		requirement.Min = 16
+	case CompareVersions(mcver, "1.20.5") < 0:
+		requirement.Min = 17
+	default:
+		requirement.Min = 21
+	}
+
+	// Forge before 1.13 relies on Java 8 internals and breaks on anything newer.
+	if loaderName(loader) == "forge" && GetForgeGeneration(mcver) == ForgeLegacy {
+		requirement.Max = 8
+	}
+	return requirement
+}
+
+// javaVersionExp matches the version in the output of "java -version" and in a JDK's release file.
+var javaVersionExp = regexp.MustCompile("version \"([^\"]+)\"|JAVA_VERSION=\"([^\"]+)\"")
+
+// javaMajor returns the major version of a Java version string, e.g. 8 for "1.8.0_292" and 17 for "17.0.2".
+func javaMajor(version string) int {
+	if strings.HasPrefix(version, "1.") {
+		version = version[2:]
+	}
+	return leadingInt(version)
+}
+
+// javaHomes returns the directories JDKs and JREs are commonly installed under.
+func javaHomes() []string {
+	var patterns []string
+	switch runtime.GOOS {
+	case "windows":
+		for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)"} {
+			if dir := os.Getenv(env); dir != "" {
+				patterns = append(patterns, filepath.Join(dir, "Java", "*"), filepath.Join(dir, "Eclipse Adoptium", "*"), filepath.Join(dir, "Microsoft", "jdk-*"))
+			}
+		}
+	case "darwin":
+		patterns = append(patterns, "/Library/Java/JavaVirtualMachines/*/Contents/Home")
+	default:
+		patterns = append(patterns, "/usr/lib/jvm/*", "/usr/java/*", "/opt/java/*", "/opt/jdk*")
+	}
+
+	var homes []string
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		homes = append(homes, matches...)
+	}
+	return homes
+}
+
+// javaExecutable returns the java executable for path, which may be the executable itself or a Java home.
+func javaExecutable(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return path
+	}
+
+	name := "java"
+	if runtime.GOOS == "windows" {
+		name = "java.exe"
+	}
+	return filepath.Join(path, "bin", name)
+}
+
+// ReadJavaRuntime reads the version of the java executable at path, from the release file of
+// its Java home when there is one and otherwise by running "java -version".
+func ReadJavaRuntime(path string) (JavaRuntime, error) {
+	java := JavaRuntime{Path: path}
+	_, err := os.Stat(path)
+	if err != nil {
+		return java, err
+	}
+
+	var output []byte
+	release := filepath.Join(filepath.Dir(filepath.Dir(path)), "release")
+	output, err = ioutil.ReadFile(release)
+	if err != nil || !javaVersionExp.Match(output) {
+		// "java -version" prints to stderr.
+		output, err = exec.Command(path, "-version").CombinedOutput()
+		if err != nil {
+			return java, err
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		match := javaVersionExp.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		java.Version = match[1] + match[2]
+		java.Major = javaMajor(java.Version)
+		return java, nil
+	}
+	return java, fmt.Errorf("%s: could not determine Java version", path)
+}
+
+// FindJavaRuntimes returns the Java runtimes in paths, JAVA_HOME, the usual install locations and
+// on PATH, in that order of preference.
+func FindJavaRuntimes(paths []string) []JavaRuntime {
+	candidates := append([]string{}, paths...)
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		candidates = append(candidates, home)
+	}
+	candidates = append(candidates, javaHomes()...)
+	if path, err := exec.LookPath("java"); err == nil {
+		candidates = append(candidates, path)
+	}
+
+	var runtimes []JavaRuntime
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		java := javaExecutable(candidate)
+		resolved, err := filepath.EvalSymlinks(java)
+		if err != nil || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+
+		runtime, err := ReadJavaRuntime(java)
+		if err != nil {
+			fmt.Println("FindJavaRuntimes:", err)
+			continue
+		}
+		runtimes = append(runtimes, runtime)
+	}
+	return runtimes
+}
+
+// SelectJavaRuntime returns the runtime from runtimes with the lowest major version allowed by requirement,
+// preferring earlier runtimes among those with the same major version.
+func SelectJavaRuntime(runtimes []JavaRuntime, requirement JavaRequirement) (JavaRuntime, error) {
+	var selected *JavaRuntime
+	var found []string
+	for i := range runtimes {
+		found = append(found, fmt.Sprintf("%s (%s)", runtimes[i].Path, runtimes[i].Version))
+		if requirement.Allows(runtimes[i]) && (selected == nil || runtimes[i].Major < selected.Major) {
+			selected = &runtimes[i]
+		}
+	}
+
+	if selected == nil {
+		if len(found) == 0 {
+			return JavaRuntime{}, fmt.Errorf("need %s but no Java runtimes were found, install one or add it to JavaPaths", requirement)
+		}
+		return JavaRuntime{}, fmt.Errorf("need %s but only found %s", requirement, strings.Join(found, ", "))
+	}
+	return *selected, nil
+}
+
+// javaVersionInfo returns the VersionInfo to take the Java requirement from. The Java version recorded
+// by Install is used while the installed versions match Settings, so starting the server doesn't
+// need the version manifest. Otherwise the manifest is fetched, and nil is returned if that fails.
+func (runner *McRunner) javaVersionInfo() *VersionInfo {
+	installed, err := ReadInstallInfo()
+	if err == nil && installed.JavaVersion != 0 && installed.versions() == runner.wantedInstallInfo() {
+		info := new(VersionInfo)
+		info.JavaVersion.MajorVersion = installed.JavaVersion
+		return info
+	}
+
+	info, err := runner.ResolveVersion(runner.currentSettings().MinecraftVersion)
+	if err != nil {
+		fmt.Println("Java: falling back to the built in Java requirements:", err)
+		return nil
+	}
+	return info
+}
+
+// Java returns the Java runtime to run the configured Minecraft version with.
+func (runner *McRunner) Java() (JavaRuntime, error) {
+	settings := runner.currentSettings()
+	requirement := GetJavaRequirement(settings.MinecraftVersion, settings.Loader, runner.javaVersionInfo())
+	java, err := SelectJavaRuntime(FindJavaRuntimes(settings.JavaPaths), requirement)
+	if err != nil {
+		return java, fmt.Errorf("no compatible Java runtime for Minecraft %s: %s", settings.MinecraftVersion, err)
+	}
+	return java, nil
+}
+
+// javaPath returns the path of the java executable from Java.
+func (runner *McRunner) javaPath() (string, error) {
+	java, err := runner.Java()
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(fmt.Sprintf("Using Java %s at %s", java.Version, java.Path))
+	return java.Path, nil
+}
@@ -0,0 +1,39 @@
+package mcrunner
+
+import (
+	"os"
+	"testing"
+)
+
+func TestJavaVersionInfo(t *testing.T) {
+	dir := useTempRoot(t)
+	server := serveVersionManifest(t)
+	runner := &McRunner{Settings: Settings{Loader: "vanilla", MinecraftVersion: "1.20.4", VersionManifestURL: server.URL + "/manifest.json"}}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing installed, so the manifest is used.
+	if info := runner.javaVersionInfo(); info == nil || info.JavaMajorVersion() != 17 {
+		t.Errorf("got %v from the manifest, want Java 17", info)
+	}
+
+	// The version recorded at install time is used without fetching the manifest.
+	installed := runner.wantedInstallInfo()
+	installed.JavaVersion = 16
+	err = WriteInstallInfo(installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	if info := runner.javaVersionInfo(); info == nil || info.JavaMajorVersion() != 16 {
+		t.Errorf("got %v with the manifest unreachable, want the installed Java 16", info)
+	}
+
+	// Once the settings move on, the recorded version no longer applies.
+	runner.Settings.MinecraftVersion = "1.12.2"
+	if info := runner.javaVersionInfo(); info != nil {
+		t.Errorf("got %v with the manifest unreachable, want nil", info)
+	}
+}
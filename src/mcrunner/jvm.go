@@ -0,0 +1,131 @@
+package mcrunner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// garbageCollector is a GC Settings.GC can select.
+type garbageCollector struct {
+	// flag selects the collector.
+	flag string
+	// tuning is used unless a preset tunes the collector itself.
+	tuning []string
+	// minJava is the first Java major version the collector is production ready in.
+	minJava int
+}
+
+// garbageCollectors are keyed by their Settings.GC name.
+var garbageCollectors = map[string]garbageCollector{
+	"g1":         {"-XX:+UseG1GC", []string{"-XX:MaxGCPauseMillis=50"}, 8},
+	"parallel":   {"-XX:+UseParallelGC", nil, 8},
+	"shenandoah": {"-XX:+UseShenandoahGC", nil, 12},
+	"zgc":        {"-XX:+UseZGC", nil, 15},
+}
+
+// jvmPreset is a named set of tuned JVM flags for Settings.JVMPreset.
+type jvmPreset struct {
+	// gc is the garbage collector the preset is tuned for.
+	gc string
+	// flags returns the preset's flags, apart from the one selecting the GC, for a heap of maxRAM
+	// megabytes on java.
+	flags func(maxRAM int, java JavaRuntime) []string
+}
+
+// jvmPresets are keyed by their Settings.JVMPreset name.
+var jvmPresets = map[string]jvmPreset{
+	// Aikar's flags (https://mcflags.emc.gs), which work best with MinRAM equal to MaxRAM.
+	"aikar": {"g1", func(maxRAM int, java JavaRuntime) []string {
+		newSize, maxNewSize, regionSize, reserve, occupancy := "30", "40", "8M", "20", "15"
+		if maxRAM > 12*1024 {
+			newSize, maxNewSize, regionSize, reserve, occupancy = "40", "50", "16M", "15", "20"
+		}
+		return []string{"-XX:+ParallelRefProcEnabled", "-XX:MaxGCPauseMillis=200",
+			"-XX:+UnlockExperimentalVMOptions", "-XX:+DisableExplicitGC", "-XX:+AlwaysPreTouch",
+			"-XX:G1NewSizePercent=" + newSize, "-XX:G1MaxNewSizePercent=" + maxNewSize,
+			"-XX:G1HeapRegionSize=" + regionSize, "-XX:G1ReservePercent=" + reserve,
+			"-XX:G1HeapWastePercent=5", "-XX:G1MixedGCCountTarget=4",
+			"-XX:InitiatingHeapOccupancyPercent=" + occupancy, "-XX:G1MixedGCLiveThresholdPercent=90",
+			"-XX:G1RSetUpdatingPauseIntervalMillis=5", "-XX:SurvivorRatio=32", "-XX:+PerfDisableSharedMem",
+			"-XX:MaxTenuringThreshold=1", "-Dusing.aikars.flags=https://mcflags.emc.gs", "-Daikars.new.flags=true"}
+	}},
+	// ZGC keeps pauses short however big the heap is, so it suits servers with lots of memory.
+	"zgc": {"zgc", func(maxRAM int, java JavaRuntime) []string {
+		flags := []string{"-XX:+AlwaysPreTouch", "-XX:+DisableExplicitGC", "-XX:+PerfDisableSharedMem"}
+		// Generational ZGC is opt in on Java 21 and 22, and the only mode from 23 on.
+		if java.Major == 21 || java.Major == 22 {
+			flags = append(flags, "-XX:+ZGenerational")
+		}
+		return flags
+	}},
+}
+
+// selectedGC returns the name of the garbage collector settings select, G1 if none is.
+func (settings Settings) selectedGC() string {
+	if settings.GC != "" {
+		return settings.GC
+	}
+	if preset, ok := jvmPresets[settings.JVMPreset]; ok {
+		return preset.gc
+	}
+	return "g1"
+}
+
+// validateJVM returns the problems with the JVM settings.
+func (settings Settings) validateJVM() []string {
+	var errs []string
+	if settings.MinRAM < 0 || settings.MinRAM > settings.MaxRAM {
+		errs = append(errs, fmt.Sprintf("MinRAM %d must be between 0 and MaxRAM %d", settings.MinRAM, settings.MaxRAM))
+	}
+	if _, ok := garbageCollectors[settings.GC]; settings.GC != "" && !ok {
+		errs = append(errs, fmt.Sprintf("GC %q must be g1, parallel, shenandoah or zgc", settings.GC))
+	}
+	if preset, ok := jvmPresets[settings.JVMPreset]; settings.JVMPreset != "" && !ok {
+		errs = append(errs, fmt.Sprintf("JVMPreset %q must be aikar or zgc", settings.JVMPreset))
+	} else if ok && settings.GC != "" && settings.GC != preset.gc {
+		errs = append(errs, fmt.Sprintf("GC %s conflicts with JVMPreset %s, which uses %s", settings.GC, settings.JVMPreset, preset.gc))
+	}
+	for _, arg := range settings.JVMArgs {
+		// Anything else would be taken as the class to run, or replace the launch target.
+		if !strings.HasPrefix(arg, "-") || arg == "-jar" || arg == "-cp" || arg == "-classpath" {
+			errs = append(errs, fmt.Sprintf("JVMArgs %q isn't a JVM option", arg))
+		}
+	}
+	return errs
+}
+
+// JVMFlags returns the JVM flags the server is started with on java: the heap sizes, the garbage
+// collector, the preset's tuning, then JVMArgs, which come last so they take precedence.
+func (settings Settings) JVMFlags(java JavaRuntime) ([]string, error) {
+	var args []string
+	if settings.MinRAM > 0 {
+		args = append(args, fmt.Sprintf("-Xms%dM", settings.MinRAM))
+	}
+	args = append(args, fmt.Sprintf("-Xmx%dM", settings.MaxRAM))
+
+	name := settings.selectedGC()
+	gc := garbageCollectors[name]
+	if java.Major < gc.minJava {
+		return nil, fmt.Errorf("GC %s needs Java %d or newer, the server is running on Java %d", name, gc.minJava, java.Major)
+	}
+	args = append(args, gc.flag)
+	if preset, ok := jvmPresets[settings.JVMPreset]; ok {
+		args = append(args, preset.flags(settings.MaxRAM, java)...)
+	} else {
+		args = append(args, gc.tuning...)
+	}
+
+	return append(args, settings.JVMArgs...), nil
+}
+
+// quoteCommandLine joins args into a command line for the logs, quoting those with spaces.
+func quoteCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"") {
+			arg = "\"" + strings.Replace(arg, "\"", "\\\"", -1) + "\""
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
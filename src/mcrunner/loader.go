@@ -0,0 +1,85 @@
+package mcrunner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultLoader name of the loader used when Settings doesn't name one.
+const DefaultLoader = "forge"
+
+// Loader encapsulates installing and launching a specific kind of server.
+type Loader interface {
+	// Name returns the name used to select the loader in Settings.
+	Name() string
+	// Install installs the loader, and the vanilla server it needs, into the mcserver directory.
+	Install(runner *McRunner) error
+	// LaunchTarget returns the path, relative to the mcserver directory, of the file that exists once installed.
+	LaunchTarget(mcver, loaderver string) string
+	// LaunchArgs returns the java arguments that launch the server, to be placed after any JVM flags.
+	LaunchArgs(mcver, loaderver string) []string
+	// InstalledFiles returns the paths, relative to the mcserver directory, that Install created.
+	InstalledFiles(info InstallInfo) []string
+	// TPSCommand returns the console command that reports TPS, or "" if the loader has none.
+	TPSCommand() string
+	// ParseTPS parses a line matching LogPatterns().TPS into TPS keyed by dimension.
+	ParseTPS(line string) map[string]float32
+	// LogPatterns returns the patterns used to recognize lines in the server's output.
+	LogPatterns() *LogPatterns
+}
+
+// LogPatterns holds the patterns recognizing interesting lines of server output.
+type LogPatterns struct {
+	// Message matches chat messages, the message itself starts at the first '<'.
+	Message *regexp.Regexp
+	// TPS matches the output of the loader's TPSCommand, nil if it has none.
+	TPS *regexp.Regexp
+	// Players matches the output of "list", the player count is the first number after "There are".
+	Players *regexp.Regexp
+	// Done matches the line printed once the server is ready for players.
+	Done *regexp.Regexp
+}
+
+// playersPattern matches the player count line of "list" in its formats across versions, e.g.
+// "There are 0/20 players online:" and "There are 0 of a max of 20 players online:", but not other
+// lines starting with "There are" such as the output of "datapack list".
+const playersPattern = "There are [0-9]+ ?(/|of a max (of )?|out of maximum )[0-9]+ players online"
+
+// vanillaLogPatterns matches the output of the vanilla server, also used by Fabric and Quilt.
+var vanillaLogPatterns = &LogPatterns{
+	Message: regexp.MustCompile("^\\[[^\\]]*\\] \\[[^\\]]*INFO\\]: <.*>"),
+	Players: regexp.MustCompile("^\\[[^\\]]*\\] \\[[^\\]]*INFO\\]: " + playersPattern),
+	Done:    regexp.MustCompile("^\\[[^\\]]*\\] \\[[^\\]]*INFO\\]: Done"),
+}
+
+// loaders contains every known Loader, keyed by name.
+var loaders = map[string]Loader{
+	"forge":   ForgeLoader{},
+	"fabric":  FabricLoader{},
+	"quilt":   QuiltLoader{},
+	"vanilla": VanillaLoader{},
+	"paper":   PaperLoader{},
+}
+
+// loaderName returns the normalized loader name, substituting DefaultLoader for an empty name.
+func loaderName(name string) string {
+	if name == "" {
+		return DefaultLoader
+	}
+	return strings.ToLower(name)
+}
+
+// GetLoader returns the Loader with the given name.
+func GetLoader(name string) (Loader, error) {
+	loader, ok := loaders[loaderName(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown loader %q", name)
+	}
+	return loader, nil
+}
+
+// Loader returns the Loader selected in Settings.
+func (runner *McRunner) Loader() (Loader, error) {
+	return GetLoader(runner.currentSettings().Loader)
+}
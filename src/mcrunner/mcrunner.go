@@ -1,12 +1,13 @@
 package mcrunner
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -35,25 +36,119 @@ const (
 	Starting State = 1
 	// Running indicates the server is ready for players to connect to.
 	Running State = 2
+	// Installing indicates the server is being installed before it is started.
+	Installing State = 3
 )
 
 const (
 	// MinecraftServerDirectory name of the directory underneath the main.exe containing all mcserver data
 	MinecraftServerDirectory = "mcserver"
 	MinecraftServerJar       = "forge-universal.jar"
+	// InstallInfoFile name of the file inside the mcserver directory recording the installed versions
+	InstallInfoFile = "install.json"
+	// EulaFile name of the file inside the mcserver directory recording acceptance of the Minecraft EULA
+	EulaFile = "eula.txt"
 )
 
+// StopTimeout is how long the server is given to save and exit after "stop" before it is killed.
+const StopTimeout = 60 * time.Second
+
+// ErrEulaNotAccepted is returned by Start when Settings.AcceptEULA isn't set.
+var ErrEulaNotAccepted = errors.New("the Minecraft EULA (https://aka.ms/MinecraftEULA) must be accepted by setting AcceptEULA in settings.json")
+
 // Settings encapsulates some basic settings for the server.
+// Fields tagged reload:"hot" take effect as soon as the settings are reloaded, reload:"wrapper"
+// fields need mcrunner itself restarted, and the rest take effect when the server is restarted.
+// Fields tagged secret:"true" are masked when the bot reads them.
 type Settings struct {
-	Directory         string
-	Name              string
+	Directory         string `reload:"hot"`
+	Name              string `reload:"hot"`
 	MOTD              string
-	ListenAddress     string
+	ListenAddress     string `reload:"wrapper"`
 	MaxRAM            int
 	MaxPlayers        int
 	Port              int
-	PassthroughStdErr bool
-	PassthroughStdOut bool
+	PassthroughStdErr bool `reload:"hot"`
+	PassthroughStdOut bool `reload:"hot"`
+	// AcceptEULA indicates agreement to the Minecraft EULA (https://aka.ms/MinecraftEULA), without which the server won't start.
+	AcceptEULA bool `reload:"hot"`
+
+	Loader               string
+	MinecraftVersion     string
+	LoaderVersion        string
+	LaunchWrapperVersion string
+	InstallerVersion     string
+
+	VersionManifestURL string `reload:"hot"`
+	PaperAPIURL        string `reload:"hot"`
+
+	// CacheDirectory holds downloaded artifacts so they can be shared between instances and reused offline.
+	CacheDirectory string `reload:"hot"`
+	// Mirrors maps URL prefixes, e.g. "https://maven.minecraftforge.net/", to the prefix that replaces them.
+	Mirrors map[string]string `reload:"hot"`
+	// Offline installs only from CacheDirectory without touching the network. Only vanilla and
+	// Forge before 1.13 can be installed this way, the other loaders download their own files.
+	Offline bool `reload:"hot"`
+	// JavaPaths are extra java executables or Java homes to consider before the ones found on the system.
+	JavaPaths []string `reload:"hot"`
+
+	CurseForgeAPIURL string `reload:"hot"`
+	CurseForgeAPIKey string `reload:"hot" secret:"true"`
+	// Modpack is a CurseForge zip or Modrinth .mrpack imported by Install, overriding the versions above.
+	Modpack string
+	// ClientOnlyMods are mod IDs or jar file globs quarantined before start, in addition to the mods
+	// whose metadata says they only run on the client.
+	ClientOnlyMods []string `reload:"hot"`
+	// ServerMods are mod IDs or jar file globs never quarantined, for mods wrongly marked as client only.
+	ServerMods []string `reload:"hot"`
+
+	// ServerIcon is an image scaled to the 64x64 server-icon.png. Relative paths are inside the mcserver directory.
+	ServerIcon string
+	// ResourcePack is a resource pack zip served to players from ListenAddress. Relative paths are inside the mcserver directory.
+	ResourcePack string
+	// PublicAddress is the base URL players reach ListenAddress at, e.g. "http://mc.example.com:8080".
+	PublicAddress string
+	// Properties are set in server.properties, e.g. "difficulty": "hard". Keys that have their own
+	// field above, such as server-port, are overridden by that field.
+	Properties map[string]string
+
+	// MinRAM is the initial heap size in megabytes, 0 to leave it to the JVM.
+	MinRAM int
+	// GC selects the garbage collector: "g1", "parallel", "shenandoah" or "zgc". Empty uses the
+	// JVMPreset's, or G1.
+	GC string
+	// JVMPreset adds tuned JVM flags: "aikar" for Aikar's G1 flags, or "zgc" for ZGC on big heaps.
+	JVMPreset string
+	// JVMArgs are extra JVM flags, added last so they override the generated ones.
+	JVMArgs []string
+
+	// StatusInterval is the number of seconds between status updates sent to the bot.
+	StatusInterval int `reload:"hot"`
+	// RebootOnReload schedules a reboot when settings.json is reloaded with changes that need one.
+	RebootOnReload bool `reload:"hot"`
+	// BackupsKept is how many upgrade and config backups of each kind are kept in the backups
+	// directory, the oldest are deleted past it. 0 keeps them all.
+	BackupsKept int `reload:"hot"`
+}
+
+// InstallInfo records which versions are currently installed in the mcserver directory.
+type InstallInfo struct {
+	Loader               string
+	MinecraftVersion     string
+	LoaderVersion        string
+	LaunchWrapperVersion string
+	InstallerVersion     string
+	Modpack              string
+	// JavaVersion is the minimum Java major version from the version manifest, recorded so
+	// starting the server doesn't need the manifest. 0 if it couldn't be fetched.
+	JavaVersion int `json:",omitempty"`
+}
+
+// versions returns info without the details recorded alongside the versions, for comparing
+// against wantedInstallInfo.
+func (info InstallInfo) versions() InstallInfo {
+	info.JavaVersion = 0
+	return info
 }
 
 // Status stores information on the status of the minecraft server.
@@ -68,28 +163,65 @@ type Status struct {
 	Storage     uint64          `json:"storage"`
 	StorageMax  uint64          `json:"storagemax"`
 	TPS         json.RawMessage `json:"tps"`
+	// InstallPhase is the step Install is on while Installing.
+	InstallPhase string `json:"installphase,omitempty"`
+	// Error is why the server last failed to start, if it did.
+	Error string `json:"error,omitempty"`
+	// CommandLine is the command the server was last started with.
+	CommandLine string `json:"commandline,omitempty"`
 }
 
 // McRunner encapsulates the idea of running a minecraft server.
 type McRunner struct {
 	FirstStart bool
-	Settings   Settings
-	State      State
+	// Settings are replaced by settings commands, modpack imports and upgrades from several
+	// goroutines. They are read with currentSettings and changed with updateSettings.
+	Settings Settings
+	// State is changed by the goroutines watching the server process, it is read with state and
+	// changed with setState.
+	State State
 
 	WaitGroup            sync.WaitGroup
 	StatusRequestChannel chan bool
 	StatusChannel        chan *Status
 	MessageChannel       chan string
-	CommandChannel       chan string
+	CommandChannel       chan *Command
+	SettingsChannel      chan *SettingsRequest
+	AccessChannel        chan *AccessRequest
+	ResponseChannel      chan *Response
 
 	inPipe    io.WriteCloser
 	inMutex   sync.Mutex
 	outPipe   io.ReadCloser
 	cmd       *exec.Cmd
 	startTime time.Time
-
-	killChannel   chan bool
-	tpsChannel    chan map[int]float32
+	// listeners receive every line of output while a command waits for its response.
+	listeners      []chan string
+	listenersMutex sync.Mutex
+	// settingsMutex is held while Settings are replaced, and by currentSettings.
+	settingsMutex sync.RWMutex
+	// installPhase is the step Install is on, reported in Status and progress messages.
+	installPhase string
+	// startError is the error from the last failed Start, reported in Status.
+	startError string
+	// commandLine is the command the server was last started with, reported in Status.
+	commandLine string
+	// monitoring is set once the goroutines watching the server process are running.
+	monitoring bool
+
+	// processMutex is held while State, exited and keepAlive are read or changed.
+	processMutex sync.Mutex
+	// exited is closed when the current server process exits.
+	exited chan bool
+	// keepAlive restarts the server when it exits, it is cleared when the server is stopped on purpose.
+	keepAlive bool
+	// upgrading is 1 while an upgrade runs in the background, see upgradeRefuses.
+	upgrading int32
+	// upgradeStop is closed when the server is stopped or killed during an upgrade, so the upgrade
+	// rolls back and leaves it stopped.
+	upgradeStop chan bool
+
+	tpsChannel    chan map[string]float32
 	playerChannel chan int
 }
 
@@ -109,69 +241,171 @@ func ServerJarName(mcVer string, forgeVer string) string {
 	return fmt.Sprintf("forge-%s-%s-universal.jar", mcVer, forgeVer)
 }
 
+// Installed returns true if the server launch target exists and matches the versions in Settings.
 func (runner *McRunner) Installed() bool {
-	_, err := os.Stat(filepath.Join(McServerPath(), MinecraftServerJar))
-	return err == nil
+	settings := runner.currentSettings()
+	loader, err := runner.Loader()
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(McServerPath(), loader.LaunchTarget(settings.MinecraftVersion, settings.LoaderVersion)))
+	if err != nil {
+		return false
+	}
+
+	info, err := ReadInstallInfo()
+	if err != nil {
+		return false
+	}
+	return info.versions() == runner.wantedInstallInfo()
 }
 
-func DownloadFile(localpath, netpath string, returnIfExists bool) error {
-	_, err := os.Stat(localpath)
-	if err == nil && returnIfExists {
-		return nil
+// wantedInstallInfo returns the InstallInfo described by the current Settings.
+func (runner *McRunner) wantedInstallInfo() InstallInfo {
+	settings := runner.currentSettings()
+	return InstallInfo{
+		Loader:               loaderName(settings.Loader),
+		MinecraftVersion:     settings.MinecraftVersion,
+		LoaderVersion:        settings.LoaderVersion,
+		LaunchWrapperVersion: settings.LaunchWrapperVersion,
+		InstallerVersion:     settings.InstallerVersion,
+		Modpack:              settings.Modpack,
 	}
+}
 
-	localpathfile, err := os.Create(localpath)
+// ReadInstallInfo reads the InstallInfo written by the last successful Install.
+func ReadInstallInfo() (*InstallInfo, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(McServerPath(), InstallInfoFile))
 	if err != nil {
-		fmt.Println("Download file: Create file:", err)
-		return err
+		return nil, err
+	}
+
+	info := new(InstallInfo)
+	err = json.Unmarshal(bytes, info)
+	if err != nil {
+		return nil, err
 	}
-	defer localpathfile.Close()
+	info.Loader = loaderName(info.Loader)
+	return info, nil
+}
 
-	response, err := http.Get(netpath)
+// WriteInstallInfo records info as the currently installed versions.
+func WriteInstallInfo(info InstallInfo) error {
+	infoJSON, err := json.MarshalIndent(info, "", "    ")
 	if err != nil {
-		fmt.Println("DownloadFile: downloading:", err)
 		return err
 	}
-	defer response.Body.Close()
+	return ioutil.WriteFile(filepath.Join(McServerPath(), InstallInfoFile), infoJSON, 0644)
+}
 
-	_, err = io.Copy(localpathfile, response.Body)
+// Uninstall removes the jars belonging to a previous install so a different version can be installed.
+// World data, configs and mods are left untouched.
+func (runner *McRunner) Uninstall(info InstallInfo) error {
+	fmt.Println(fmt.Sprintf("Removing installed Minecraft %s, %s %s", info.MinecraftVersion, info.Loader, info.LoaderVersion))
+	loader, err := GetLoader(info.Loader)
 	if err != nil {
-		fmt.Println("DownloadFile: copying stream:", err)
+		fmt.Println("Uninstall: GetLoader:", err)
 		return err
 	}
 
+	for _, file := range append(loader.InstalledFiles(info), InstallInfoFile) {
+		err := os.RemoveAll(filepath.Join(McServerPath(), file))
+		if err != nil {
+			fmt.Println("Uninstall: Remove:", err)
+			return err
+		}
+	}
 	return nil
 }
 
+// InstallForgeJar installs Forge, either by downloading the legacy universal jar or by running the installer.
 func (runner *McRunner) InstallForgeJar(mcver, forgever string) error {
-	installerjarname := "forge-universal.jar"
-	installerjarpath := filepath.Join(McServerPath(), installerjarname)
-	installernetpath := fmt.Sprintf("https://files.minecraftforge.net/maven/net/minecraftforge/forge/%s-%s/%s", mcver, forgever, ServerJarName(mcver, forgever))
-	err := DownloadFile(installerjarpath, installernetpath, true)
+	if GetForgeGeneration(mcver) == ForgeLegacy {
+		installerjarname := "forge-universal.jar"
+		installerjarpath := filepath.Join(McServerPath(), installerjarname)
+		installernetpath := fmt.Sprintf("https://files.minecraftforge.net/maven/net/minecraftforge/forge/%s-%s/%s", mcver, forgever, ServerJarName(mcver, forgever))
+		err := runner.downloadFile(installerjarpath, installernetpath, true)
+		if err != nil {
+			fmt.Println("InstallForgeJar:", err)
+			return err
+		}
+		return nil
+	}
+
+	installerjarpath := filepath.Join(McServerPath(), ForgeInstallerJar)
+	installernetpath := fmt.Sprintf("https://maven.minecraftforge.net/net/minecraftforge/forge/%s-%s/%s", mcver, forgever, ForgeInstallerJarName(mcver, forgever))
+	err := runner.downloadFile(installerjarpath, installernetpath, false)
+	if err != nil {
+		fmt.Println("InstallForgeJar: DownloadFile:", err)
+		return err
+	}
+	defer os.Remove(installerjarpath)
+
+	java, err := runner.javaPath()
+	if err != nil {
+		fmt.Println("InstallForgeJar: javaPath:", err)
+		return err
+	}
+
+	runner.setInstallPhase("Running Forge installer")
+	err = runForgeInstaller(java, installerjarpath)
 	if err != nil {
 		fmt.Println("InstallForgeJar:", err)
 		return err
 	}
+
+	_, err = os.Stat(filepath.Join(McServerPath(), ForgeLaunchTarget(mcver, forgever)))
+	if err != nil {
+		fmt.Println("InstallForgeJar: installer did not produce launch target:", err)
+		return err
+	}
 	return nil
 }
 
+// MinecraftServerJarName returns the file name the vanilla server jar is installed as.
+func MinecraftServerJarName(mcver string) string {
+	return fmt.Sprintf("minecraft_server.%s.jar", mcver)
+}
+
+// InstallMinecraftServerJar downloads the vanilla server jar, resolved through the version manifest.
 func (runner *McRunner) InstallMinecraftServerJar(mcver string) error {
-	jarname := fmt.Sprintf("minecraft_server.%s.jar", mcver)
-	netpath := fmt.Sprintf("https://s3.amazonaws.com/Minecraft.Download/versions/%s/%s", mcver, jarname)
-	jarpath := filepath.Join(McServerPath(), jarname)
-	err := DownloadFile(jarpath, netpath, true)
+	info, err := runner.ResolveVersion(mcver)
 	if err != nil {
-		fmt.Println("InstallMinecraftServerJar: DownloadFile:", err)
+		fmt.Println("InstallMinecraftServerJar: ResolveVersion:", err)
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Minecraft %s requires Java %d", info.ID, info.JavaMajorVersion()))
+
+	server, err := info.Server()
+	if err != nil {
+		fmt.Println("InstallMinecraftServerJar:", err)
+		return err
+	}
+
+	download := Download{
+		LocalPath:      filepath.Join(McServerPath(), MinecraftServerJarName(mcver)),
+		URL:            server.URL,
+		Checksum:       SHA1(server.SHA1),
+		ReturnIfExists: true,
+	}
+	err = runner.Download(download)
+	if err != nil {
+		fmt.Println("InstallMinecraftServerJar: Download:", err)
 		return err
 	}
 	return nil
 }
 
+func launchWrapperPath(wrapperver string) string {
+	return fmt.Sprintf("net/minecraft/launchwrapper/%s/launchwrapper-%s.jar", wrapperver, wrapperver)
+}
+
 func (runner *McRunner) InstallLaunchWrapper(wrapperver string) error {
-	path := fmt.Sprintf("net/minecraft/launchwrapper/%s/launchwrapper-%s.jar", wrapperver, wrapperver)
+	path := launchWrapperPath(wrapperver)
 	webpath := fmt.Sprintf("https://libraries.minecraft.net/%s", path)
 	localpath := filepath.Join(McServerPath(), "libraries", path)
-	err := DownloadFile(localpath, webpath, true)
+	err := runner.downloadFile(localpath, webpath, true)
 	if err != nil {
 		fmt.Println("InstallLaunchWrapper: DownloadFile:", err)
 		return err
@@ -179,76 +413,157 @@ func (runner *McRunner) InstallLaunchWrapper(wrapperver string) error {
 	return nil
 }
 
+// HandleEula writes eula.txt if Settings accepts the EULA, and returns ErrEulaNotAccepted if it doesn't.
 func (runner *McRunner) HandleEula() error {
-	eulacmd := exec.Command("java", "-jar", "forge-universal.jar", "-Xmx2G", "nogui")
-	eulacmd.Dir = McServerPath()
-	fmt.Println("Generating eula")
-	err := eulacmd.Run()
-	if err != nil {
-		fmt.Println("HandleEula: Running java:", err)
-		return err
+	if !runner.currentSettings().AcceptEULA {
+		return ErrEulaNotAccepted
 	}
 
-	eulafilepath := filepath.Join(McServerPath(), "eula.txt")
-	_, err = os.Stat(eulafilepath)
+	eula := fmt.Sprintf("#By changing the setting below to TRUE you are indicating your agreement to our EULA (https://aka.ms/MinecraftEULA).\n#%s\neula=true\n", time.Now().Format(time.UnixDate))
+	err := ioutil.WriteFile(filepath.Join(McServerPath(), EulaFile), []byte(eula), 0644)
 	if err != nil {
-		fmt.Println("HandleEula: Stat:", err)
+		fmt.Println("HandleEula: WriteFile:", err)
 		return err
 	}
 
-	eulafile, err := ioutil.ReadFile(eulafilepath)
-	if err != nil {
-		fmt.Println("HandleEula: ReadFile:", err)
-		return err
-	}
+	return nil
+}
 
-	newEula := strings.Replace(string(eulafile), "false", "true", -1)
-	err = ioutil.WriteFile(eulafilepath, []byte(newEula), 0)
+// Install installs the loader and versions in Settings, replacing any other installed version.
+// If Settings names a Modpack that isn't installed yet, it is imported first.
+// The runner is Installing until it returns, with progress reported to the bot.
+func (runner *McRunner) Install() error {
+	previousState := runner.state()
+	runner.setState(Installing)
+	defer func() {
+		runner.setState(previousState)
+		runner.installPhase = ""
+	}()
+
+	err := runner.install()
 	if err != nil {
-		fmt.Println("HandleEula: Replace:", err)
+		runner.installFailed(err)
 		return err
 	}
-
+	runner.setInstallPhase("Install complete")
 	return nil
 }
 
-func (runner *McRunner) Install() error {
-	mcver := "1.12.2"
-	forgever := "14.23.5.2836"
-	launchwrapperver := "1.12"
-	err := runner.InstallForgeJar(mcver, forgever)
-	if err != nil {
-		fmt.Println("Install: InstallForgeJar:", err)
-		return err
+// install does the work of Install.
+func (runner *McRunner) install() error {
+	settings := runner.currentSettings()
+	previous, previousErr := ReadInstallInfo()
+	if settings.Modpack != "" && (previousErr != nil || previous.Modpack != settings.Modpack) {
+		runner.setInstallPhase(fmt.Sprintf("Importing modpack %s", filepath.Base(settings.Modpack)))
+		err := runner.ImportModpack(settings.Modpack)
+		if err != nil {
+			fmt.Println("Install: ImportModpack:", err)
+			return err
+		}
+		// The modpack's versions replace the ones in settings.
+		settings = runner.currentSettings()
 	}
 
-	err = runner.InstallLaunchWrapper(launchwrapperver)
+	loader, err := runner.Loader()
 	if err != nil {
-		fmt.Println("Install: InstallLaunchWrapper:", err)
+		fmt.Println("Install: Loader:", err)
 		return err
 	}
 
-	err = runner.InstallMinecraftServerJar(mcver)
+	if settings.MinecraftVersion == "" {
+		return fmt.Errorf("Install: MinecraftVersion must be set")
+	}
+	if settings.LoaderVersion == "" && loader.Name() != "vanilla" {
+		return fmt.Errorf("Install: LoaderVersion must be set for %s", loader.Name())
+	}
+
+	if previousErr == nil && previous.versions() != runner.wantedInstallInfo() {
+		runner.setInstallPhase("Installed versions differ from settings, removing them")
+		err = runner.Uninstall(*previous)
+		if err != nil {
+			fmt.Println("Install: Uninstall:", err)
+			return err
+		}
+	} else if previousErr != nil {
+		// Nothing recorded, so an existing launch target may be for any version; fetch it again.
+		os.Remove(filepath.Join(McServerPath(), loader.LaunchTarget(settings.MinecraftVersion, settings.LoaderVersion)))
+	}
+
+	runner.setInstallPhase(fmt.Sprintf("Installing %s %s for Minecraft %s", loader.Name(), settings.LoaderVersion, settings.MinecraftVersion))
+	err = loader.Install(runner)
 	if err != nil {
-		fmt.Println("Install: InstallMinecraftServerJar:", err)
+		fmt.Println("Install: Loader.Install:", err)
 		return err
 	}
 
-	err = runner.HandleEula()
+	installed := runner.wantedInstallInfo()
+	if info := runner.javaVersionInfo(); info != nil {
+		installed.JavaVersion = info.JavaMajorVersion()
+	}
+	err = WriteInstallInfo(installed)
 	if err != nil {
-		fmt.Println("Install: HandleEula:", err)
+		fmt.Println("Install: WriteInstallInfo:", err)
 		return err
 	}
 
 	return nil
 }
 
-// Start initializes the runner and starts the minecraft server up.
+// Start initializes the runner and starts the minecraft server up, restarting it whenever it exits
+// until it is stopped.
 func (runner *McRunner) Start() error {
-	if runner.State != NotRunning {
+	return runner.startServer(true)
+}
+
+// startServer starts the server, restarting it when it exits if keepAlive is set.
+func (runner *McRunner) startServer(keepAlive bool) error {
+	if runner.state() != NotRunning {
 		return nil
 	}
 
+	if runner.FirstStart {
+		runner.FirstStart = false
+
+		// Initialize McRunner members that aren't initialized yet.
+		runner.tpsChannel = make(chan map[string]float32, 8)
+		runner.playerChannel = make(chan int, 1)
+
+		// Keep answering the bot even if the server can't be started.
+		go runner.updateStatus()
+		go runner.processCommands()
+	}
+
+	err := runner.start(keepAlive)
+	if err != nil {
+		runner.startError = err.Error()
+		runner.respond("status", runner.status())
+		return err
+	}
+	runner.startError = ""
+
+	if !runner.monitoring {
+		runner.monitoring = true
+		go runner.processOutput()
+	}
+
+	return nil
+}
+
+// start installs the server if needed and launches it.
+func (runner *McRunner) start(keepAlive bool) error {
+	settings := runner.currentSettings()
+	err := settings.Validate()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	// Checked before installing so a missing acceptance is reported without waiting for downloads.
+	if !settings.AcceptEULA {
+		fmt.Println(ErrEulaNotAccepted)
+		return ErrEulaNotAccepted
+	}
+
 	if !runner.Installed() {
 		fmt.Println("Installing server")
 		err := runner.Install()
@@ -259,68 +574,117 @@ func (runner *McRunner) Start() error {
 	}
 	fmt.Println("Server installed")
 
+	err = runner.HandleEula()
+	if err != nil {
+		fmt.Println("Start: HandleEula:", err)
+		return err
+	}
+
+	// A client only mod crashes the whole server, so quarantine them instead. Failing to is only
+	// reported, the server may well start anyway.
+	quarantined, err := runner.QuarantineClientMods()
+	if err != nil {
+		fmt.Println("Start: QuarantineClientMods:", err)
+	}
+	if len(quarantined) > 0 {
+		runner.respond("quarantine", quarantined)
+	}
+
+	loader, err := runner.Loader()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	java, err := runner.Java()
+	if err != nil {
+		fmt.Println("Start: Java:", err)
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Using Java %s at %s", java.Version, java.Path))
+
+	// JVM flags must come before the launch target, anything after it is passed to the server.
+	args, err := settings.JVMFlags(java)
+	if err != nil {
+		fmt.Println("Start: JVMFlags:", err)
+		return err
+	}
+
 	runner.applySettings()
-	runner.cmd = exec.Command("java", "-jar", "forge-universal.jar", "-Xms512M", fmt.Sprintf("-Xmx%dM", runner.Settings.MaxRAM), "-XX:+UseG1GC", "-XX:+UseCompressedOops", "-XX:MaxGCPauseMillis=50", "-XX:UseSSE=4", "-XX:+UseNUMA", "nogui")
+	args = append(args, loader.LaunchArgs(settings.MinecraftVersion, settings.LoaderVersion)...)
+	runner.cmd = exec.Command(java.Path, append(args, "nogui")...)
+	runner.commandLine = quoteCommandLine(runner.cmd.Args)
+	fmt.Println("Launching:", runner.commandLine)
 	runner.cmd.Dir = McServerPath()
 	runner.inPipe, _ = runner.cmd.StdinPipe()
 	runner.outPipe, _ = runner.cmd.StdoutPipe()
-	if runner.Settings.PassthroughStdErr {
-		runner.cmd.Stderr = os.Stderr
-	}
-	err := runner.cmd.Start()
+	runner.cmd.Stderr = stderrPassthrough{runner}
+	err = runner.cmd.Start()
 	if err != nil {
 		fmt.Print(err)
 		return err
 	}
-	runner.State = Starting
 	runner.startTime = time.Now()
+	exited := make(chan bool)
+	runner.processMutex.Lock()
+	runner.State = Starting
+	runner.keepAlive = keepAlive
+	runner.exited = exited
+	runner.processMutex.Unlock()
+	go runner.monitor(runner.cmd, exited)
 
-	if runner.FirstStart {
-		runner.FirstStart = false
+	return nil
+}
 
-		// Initialize McRunner members that aren't initialized yet.
-		runner.killChannel = make(chan bool, 3)
-		runner.tpsChannel = make(chan map[int]float32, 8)
-		runner.playerChannel = make(chan int, 1)
+// stderrPassthrough copies the server's stderr to ours while Settings.PassthroughStdErr is set.
+type stderrPassthrough struct {
+	runner *McRunner
+}
 
-		go runner.keepAlive()
-		go runner.updateStatus()
-		go runner.processCommands()
-		go runner.processOutput()
+func (passthrough stderrPassthrough) Write(p []byte) (int, error) {
+	if passthrough.runner.currentSettings().PassthroughStdErr {
+		os.Stderr.Write(p)
 	}
-
-	return err
+	return len(p), nil
 }
 
 // applySettings applies the Settings struct contained in McRunner.
 func (runner *McRunner) applySettings() {
-	propPath := filepath.Join(McServerPath(), "server.properties")
-	props, err := ioutil.ReadFile(propPath)
+	settings := runner.currentSettings()
+	if settings.ServerIcon != "" {
+		err := WriteServerIcon(serverFilePath(settings.ServerIcon))
+		if err != nil {
+			fmt.Println("applySettings: WriteServerIcon:", err)
+		}
+	}
 
+	props, err := ReadProperties(PropertiesPath())
 	if err != nil {
-		fmt.Println(err)
+		fmt.Println("applySettings: ReadProperties:", err)
 		return
 	}
 
-	nameExp, _ := regexp.Compile("displayname=.*\\n")
-	motdExp, _ := regexp.Compile("motd=.*\\n")
-	maxPlayersExp, _ := regexp.Compile("max-players=.*\\n")
-	portExp, _ := regexp.Compile("server-port=.*\\n")
-
-	name := fmt.Sprintf("displayname=%s\n", runner.Settings.Name)
-	motd := fmt.Sprintf("motd=%s\n", runner.Settings.MOTD)
-	maxPlayers := fmt.Sprintf("max-players=%d\n", runner.Settings.MaxPlayers)
-	port := fmt.Sprintf("server-port=%d\n", runner.Settings.Port)
-
-	newProps := strings.Replace(string(props), nameExp.FindString(string(props)), name, 1)
-	newProps = strings.Replace(newProps, motdExp.FindString(newProps), motd, 1)
-	newProps = strings.Replace(newProps, maxPlayersExp.FindString(newProps), maxPlayers, 1)
-	newProps = strings.Replace(newProps, portExp.FindString(newProps), port, 1)
+	for _, key := range sortedKeys(settings.Properties) {
+		props.Set(key, settings.Properties[key])
+	}
+	props.Set("displayname", settings.Name)
+	props.Set("motd", settings.MOTD)
+	props.Set("max-players", strconv.Itoa(settings.MaxPlayers))
+	props.Set("server-port", strconv.Itoa(settings.Port))
 
-	err = ioutil.WriteFile(propPath, []byte(newProps), 0644)
+	if settings.ResourcePack != "" {
+		url, sum, err := runner.resourcePack()
+		if err != nil {
+			fmt.Println("applySettings: resourcePack:", err)
+		} else {
+			props.Set("resource-pack", url)
+			props.Set("resource-pack-sha1", sum)
+		}
+	}
 
+	err = props.Write(PropertiesPath())
 	if err != nil {
-		fmt.Println(err)
+		fmt.Println("applySettings: Write:", err)
 		return
 	}
 }
@@ -330,78 +694,189 @@ func (runner *McRunner) processOutput() {
 	runner.WaitGroup.Add(1)
 	defer runner.WaitGroup.Done()
 	for {
-		select {
-		case <-runner.killChannel:
-			return
-		default:
-			buf := make([]byte, 256)
-			n, err := runner.outPipe.Read(buf)
-			str := string(buf[:n])
+		pipe := runner.outPipe
+		scanner := bufio.NewScanner(pipe)
+		for scanner.Scan() {
+			runner.processLine(scanner.Text())
+		}
 
-			if (err == nil) && (n > 1) {
-				if runner.Settings.PassthroughStdOut {
-					fmt.Print(str)
-				}
-				msgExp, _ := regexp.Compile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: <.*>")
-				tpsExp, _ := regexp.Compile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: Dim")
-				playerExp, _ := regexp.Compile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: There are")
-				doneExp, _ := regexp.Compile("\\[.*\\] \\[.*INFO\\] \\[.*DedicatedServer\\]: Done")
-
-				if runner.State == Starting {
-					if doneExp.Match(buf) {
-						runner.State = Running
-						fmt.Println("Minecraft server done loading.")
-					}
-				} else if runner.State == Running {
-					if msgExp.Match(buf) {
-						runner.MessageChannel <- str[strings.Index(str, "<"):]
-					} else if tpsExp.Match(buf) {
-						content := str[strings.Index(str, "Dim"):]
+		// The server exited and closed its output, wait for a new one to be started.
+		for runner.outPipe == pipe {
+			time.Sleep(1 * time.Second)
+		}
+	}
+}
 
-						numExp, _ := regexp.Compile("[+-]?([0-9]*[.])?[0-9]+")
-						nums := numExp.FindAllString(content, -1)
-						dim, _ := strconv.Atoi(nums[0])
-						tps, _ := strconv.ParseFloat(nums[len(nums)-1], 32)
+// processLine processes a single line of output from the server.
+func (runner *McRunner) processLine(line string) {
+	settings := runner.currentSettings()
+	if settings.PassthroughStdOut {
+		fmt.Println(line)
+	}
 
-						m := make(map[int]float32)
-						m[dim] = float32(tps)
+	runner.listenersMutex.Lock()
+	for _, listener := range runner.listeners {
+		select {
+		case listener <- line:
+		default:
+		}
+	}
+	runner.listenersMutex.Unlock()
 
-						runner.tpsChannel <- m
-					} else if playerExp.Match(buf) {
-						content := str[strings.Index(str, "There"):]
+	loader, err := GetLoader(settings.Loader)
+	if err != nil {
+		return
+	}
+	patterns := loader.LogPatterns()
 
-						numExp, _ := regexp.Compile("[+-]?([0-9]*[.])?[0-9]+")
-						players, _ := strconv.Atoi(numExp.FindString(content))
+	state := runner.state()
+	if state == Starting {
+		if patterns.Done.MatchString(line) {
+			runner.setState(Running)
+			fmt.Println("Minecraft server done loading.")
+		}
+	} else if state == Running {
+		if patterns.Message.MatchString(line) {
+			runner.MessageChannel <- line[strings.Index(line, "<"):]
+		} else if patterns.TPS != nil && patterns.TPS.MatchString(line) {
+			m := loader.ParseTPS(line)
+			if len(m) > 0 {
+				runner.tpsChannel <- m
+			}
+		} else if patterns.Players.MatchString(line) {
+			content := line[strings.Index(line, "There"):]
 
-						runner.playerChannel <- players
-					}
-				}
+			numExp, _ := regexp.Compile("[+-]?([0-9]*[.])?[0-9]+")
+			players, _ := strconv.Atoi(numExp.FindString(content))
+
+			// Don't block on list output nobody asked for.
+			select {
+			case runner.playerChannel <- players:
+			default:
 			}
 		}
 	}
 }
 
-// keepAlive monitors the minecraft server and restarts it if it dies.
-func (runner *McRunner) keepAlive() {
+// monitor waits for the server process to exit, closing exited, and restarts it if keepAlive is set.
+func (runner *McRunner) monitor(cmd *exec.Cmd, exited chan bool) {
 	runner.WaitGroup.Add(1)
 	defer runner.WaitGroup.Done()
-	for {
-		select {
-		default:
-			state, err := runner.cmd.Process.Wait()
-			if state.Exited() {
-				runner.State = NotRunning
-				if err != nil {
-					fmt.Println(err)
-				}
-				runner.Start()
-			}
-		case <-runner.killChannel:
-			return
-		}
+
+	// Process.Wait rather than cmd.Wait, which would close the output pipe under processOutput.
+	state, err := cmd.Process.Wait()
+	if err != nil {
+		fmt.Println("monitor: Wait:", err)
+	} else {
+		fmt.Println(fmt.Sprintf("Minecraft server exited: %s", state))
+	}
+	runner.processMutex.Lock()
+	runner.State = NotRunning
+	keepAlive := runner.keepAlive
+	runner.processMutex.Unlock()
+	close(exited)
+
+	if keepAlive {
+		runner.Start()
+	}
+}
+
+// Stop asks the server to stop and waits for it to exit, killing it if it takes longer than timeout.
+func (runner *McRunner) Stop(timeout time.Duration) error {
+	exited := runner.stopKeepingAlive()
+	if !runner.processRunning() {
+		return nil
+	}
+
+	runner.executeCommand("stop")
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+		fmt.Println(fmt.Sprintf("Server didn't stop within %s, killing it", timeout))
+		return runner.Kill()
 	}
 }
 
+// Kill kills the server and waits for it to exit.
+func (runner *McRunner) Kill() error {
+	exited := runner.stopKeepingAlive()
+	if !runner.processRunning() {
+		return nil
+	}
+
+	err := runner.cmd.Process.Kill()
+	if err != nil {
+		fmt.Println("Kill:", err)
+		return err
+	}
+	<-exited
+	return nil
+}
+
+// stopKeepingAlive clears keepAlive so the server isn't restarted when it exits, returning the
+// channel closed when the current server process exits.
+func (runner *McRunner) stopKeepingAlive() chan bool {
+	runner.processMutex.Lock()
+	defer runner.processMutex.Unlock()
+	runner.keepAlive = false
+	return runner.exited
+}
+
+// state returns the server's State.
+func (runner *McRunner) state() State {
+	runner.processMutex.Lock()
+	defer runner.processMutex.Unlock()
+	return runner.State
+}
+
+// setState changes the server's State.
+func (runner *McRunner) setState(state State) {
+	runner.processMutex.Lock()
+	defer runner.processMutex.Unlock()
+	runner.State = state
+}
+
+// processRunning returns true if there is a server process that hasn't exited.
+func (runner *McRunner) processRunning() bool {
+	runner.processMutex.Lock()
+	exited := runner.exited
+	runner.processMutex.Unlock()
+	if exited == nil {
+		return false
+	}
+	select {
+	case <-exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// status returns the parts of the Status that don't need the server to be running.
+func (runner *McRunner) status() *Status {
+	settings := runner.currentSettings()
+	status := new(Status)
+	status.Name = settings.Name
+	status.PlayerMax = settings.MaxPlayers
+	status.MemoryMax = settings.MaxRAM
+	status.TPS = []byte("{}")
+	status.Error = runner.startError
+	status.CommandLine = runner.commandLine
+	switch runner.state() {
+	case NotRunning:
+		status.Status = "Not Running"
+	case Starting:
+		status.Status = "Starting"
+	case Running:
+		status.Status = "Running"
+	case Installing:
+		status.Status = "Installing"
+		status.InstallPhase = runner.installPhase
+	}
+	return status
+}
+
 // updateStatus sends the status to the BotHandler when requested.
 func (runner *McRunner) updateStatus() {
 	runner.WaitGroup.Add(1)
@@ -409,38 +884,30 @@ func (runner *McRunner) updateStatus() {
 	for {
 		select {
 		case <-runner.StatusRequestChannel:
-			if runner.State != Running {
+			status := runner.status()
+			if runner.state() != Running {
+				runner.StatusChannel <- status
 				continue
 			}
 
-			status := new(Status)
-			status.Name = runner.Settings.Name
-			status.PlayerMax = runner.Settings.MaxPlayers
-			switch runner.State {
-			case NotRunning:
-				status.Status = "Not Running"
-			case Starting:
-				status.Status = "Starting"
-			case Running:
-				status.Status = "Running"
-			}
 			status.ActiveTime = int(time.Since(runner.startTime).Seconds())
 
 			proc, _ := process.NewProcess(int32(runner.cmd.Process.Pid))
 			memInfo, _ := proc.MemoryInfo()
-			status.MemoryMax = runner.Settings.MaxRAM
 			status.Memory = int(memInfo.RSS / (1024 * 1024))
 
-			worldPath := filepath.Join(McServerPath(), "world")
-			usage, _ := disk.Usage(worldPath)
+			usage, _ := disk.Usage(runner.worldPath())
 			status.Storage = usage.Used / (1024 * 1024)
 			status.StorageMax = usage.Total / (1024 * 1024)
 
 			runner.executeCommand("list")
 			status.PlayerCount = <-runner.playerChannel
 
-			tpsMap := make(map[int]float32)
-			runner.executeCommand("forge tps")
+			tpsMap := make(map[string]float32)
+			loader, _ := runner.Loader()
+			if loader != nil && loader.TPSCommand() != "" {
+				runner.executeCommand(loader.TPSCommand())
+			}
 		loop:
 			for {
 				select {
@@ -452,21 +919,14 @@ func (runner *McRunner) updateStatus() {
 					break loop
 				}
 			}
-			var tpsStrBuilder strings.Builder
-			tpsStrBuilder.WriteString("{ ")
-			for k, v := range tpsMap {
-				tpsStrBuilder.WriteString(fmt.Sprintf("\"%d\": %f, ", k, v))
+			if len(tpsMap) == 0 {
+				// Nothing reported TPS, keep the empty object from status rather than sending malformed JSON.
+				runner.StatusChannel <- status
+				continue
 			}
-			tpsStr := tpsStrBuilder.String()[:tpsStrBuilder.Len()-3]
-			tpsStrBuilder.Reset()
-			tpsStrBuilder.WriteString(tpsStr)
-			tpsStrBuilder.WriteString("}")
-			tpsStr = tpsStrBuilder.String()
-			status.TPS = []byte(tpsStr)
+			status.TPS, _ = json.Marshal(tpsMap)
 
 			runner.StatusChannel <- status
-		case <-runner.killChannel:
-			return
 		}
 	}
 }
@@ -478,43 +938,61 @@ func (runner *McRunner) processCommands() {
 	for {
 		select {
 		case command := <-runner.CommandChannel:
-			switch command {
+			if runner.upgradeRefuses(command) {
+				continue
+			}
+			switch command.Command {
 			case "start":
-				if runner.State == NotRunning {
+				if runner.state() == NotRunning {
 					runner.Start()
 				}
 			case "stop":
-				runner.executeCommand("stop")
-				runner.killChannel <- true
-				runner.killChannel <- true
-				runner.killChannel <- true
-				runner.State = NotRunning
+				runner.Stop(StopTimeout)
 			case "kill":
-				runner.cmd.Process.Kill()
-				runner.killChannel <- true
-				runner.killChannel <- true
-				runner.killChannel <- true
-				runner.State = NotRunning
+				runner.Kill()
 			case "reboot":
-				runner.executeCommand("stop")
-				time.Sleep(5 * time.Second)
+				runner.Stop(StopTimeout)
 				runner.Start()
 			case "forcereboot":
-				runner.cmd.Process.Kill()
-				time.Sleep(5 * time.Second)
+				runner.Kill()
 				runner.Start()
 			case "save":
 				runner.executeCommand("save-all")
 			default:
-				runner.executeCommand(command)
+				if !runner.handleRunnerCommand(command) {
+					runner.executeCommand(command.Command)
+				}
 			}
-		case <-runner.killChannel:
-			return
+		case request := <-runner.SettingsChannel:
+			runner.handleSettingsRequest(request)
+		case request := <-runner.AccessChannel:
+			runner.handleAccessRequest(request)
 		}
 
 	}
 }
 
+// respond sends a response to the Discord bot, dropping it if nobody is listening.
+func (runner *McRunner) respond(responseType string, data interface{}) {
+	select {
+	case runner.ResponseChannel <- &Response{Type: responseType, Data: data}:
+	default:
+		fmt.Println(fmt.Sprintf("Dropped %s response, the bot isn't keeping up.", responseType))
+	}
+}
+
+// ScheduleReboot warns players and reboots the server after delay, if it is running.
+func (runner *McRunner) ScheduleReboot(delay time.Duration) {
+	if runner.state() == NotRunning {
+		return
+	}
+
+	runner.executeCommand(fmt.Sprintf("say Server rebooting in %d seconds", int(delay.Seconds())))
+	time.AfterFunc(delay, func() {
+		runner.CommandChannel <- &Command{Command: "reboot"}
+	})
+}
+
 // executeCommand is a helper function to execute commands.
 func (runner *McRunner) executeCommand(command string) {
 	runner.inMutex.Lock()
@@ -523,3 +1001,39 @@ func (runner *McRunner) executeCommand(command string) {
 	runner.inPipe.Write([]byte(command))
 	runner.inPipe.Write([]byte("\n"))
 }
+
+// executeAndWait executes command and passes the lines of output that follow to capture until it
+// returns true, returning an error if that doesn't happen within timeout.
+func (runner *McRunner) executeAndWait(command string, timeout time.Duration, capture func(line string) bool) error {
+	if runner.state() != Running {
+		return fmt.Errorf("the server must be running to run %q", command)
+	}
+
+	listener := make(chan string, 64)
+	runner.listenersMutex.Lock()
+	runner.listeners = append(runner.listeners, listener)
+	runner.listenersMutex.Unlock()
+	defer func() {
+		runner.listenersMutex.Lock()
+		for i, l := range runner.listeners {
+			if l == listener {
+				runner.listeners = append(runner.listeners[:i], runner.listeners[i+1:]...)
+				break
+			}
+		}
+		runner.listenersMutex.Unlock()
+	}()
+
+	runner.executeCommand(command)
+	deadline := time.After(timeout)
+	for {
+		select {
+		case line := <-listener:
+			if capture(line) {
+				return nil
+			}
+		case <-deadline:
+			return fmt.Errorf("no response to %q within %s", command, timeout)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package mcrunner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTempRoot points RootPath at a new temporary directory for the rest of the test, and returns
+// the mcserver directory inside it.
+func useTempRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "mcrunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arg := os.Args[0]
+	os.Args[0] = filepath.Join(root, "mcrunner")
+	t.Cleanup(func() {
+		os.Args[0] = arg
+		os.RemoveAll(root)
+	})
+	return McServerPath()
+}
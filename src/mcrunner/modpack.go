@@ -0,0 +1,279 @@
+package mcrunner
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ModsDirectory name of the mods directory inside the mcserver directory.
+const ModsDirectory = "mods"
+
+// serverPackForgeExp matches the Forge jars and library directories server packs ship with,
+// capturing the Minecraft and Forge versions.
+var serverPackForgeExp = regexp.MustCompile("^(?:forge-|.*libraries/net/minecraftforge/forge/)([0-9.]+)-([0-9.]+)(?:-universal|-installer|-server)?(?:\\.jar|/)$")
+
+// ImportModpack imports the modpack at path, choosing the format from its extension.
+// The Settings are updated to the modpack's versions and saved, so the next Start installs them.
+// Nothing is changed unless the whole pack is imported.
+func (runner *McRunner) ImportModpack(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip", ".json":
+		return runner.ImportCurseForgePack(path)
+	case ".mrpack":
+		return runner.ImportModrinthPack(path)
+	}
+	return fmt.Errorf("ImportModpack: unrecognized modpack format %s", filepath.Base(path))
+}
+
+// modpackLaunchWrapper returns the launchwrapper version legacy Forge needs for mcver, or "" if
+// loader doesn't use one.
+func modpackLaunchWrapper(loader, mcver string) string {
+	if loaderName(loader) == "forge" && GetForgeGeneration(mcver) == ForgeLegacy && CompareVersions(mcver, "1.7.10") >= 0 {
+		return "1.12"
+	}
+	return ""
+}
+
+// setModpackVersions points Settings at the versions a modpack needs and saves them. The versions
+// that follow from them are reset too, so none are left over from the previous pack.
+func (runner *McRunner) setModpackVersions(mcver, loader, loaderver string) error {
+	_, err := GetLoader(loader)
+	if err != nil {
+		return err
+	}
+
+	if mcver == "" {
+		fmt.Println("Modpack doesn't say which versions it needs, set MinecraftVersion, Loader and LoaderVersion before starting")
+	} else {
+		fmt.Println(fmt.Sprintf("Modpack uses Minecraft %s with %s %s", mcver, loader, loaderver))
+	}
+	_, err = runner.updateSettings(func(settings *Settings) error {
+		settings.MinecraftVersion = mcver
+		settings.Loader = loader
+		settings.LoaderVersion = loaderver
+		settings.LaunchWrapperVersion = modpackLaunchWrapper(loader, mcver)
+		// Packs don't name an installer, the loader's default is the one known to work.
+		settings.InstallerVersion = ""
+		return SaveSettings(*settings)
+	})
+	return err
+}
+
+// modpackStage is a directory a modpack's files are gathered in before any of them replace the
+// server's, so an import that fails part way leaves the server as it was.
+type modpackStage struct {
+	// Path is the directory, laid out like the mcserver directory.
+	Path string
+}
+
+// newModpackStage creates an empty modpackStage inside the mcserver directory, so its files can
+// be renamed into place.
+func newModpackStage() (*modpackStage, error) {
+	err := os.MkdirAll(McServerPath(), 0755)
+	if err != nil {
+		return nil, err
+	}
+	path, err := ioutil.TempDir(McServerPath(), ".modpack-")
+	if err != nil {
+		return nil, err
+	}
+	return &modpackStage{Path: path}, nil
+}
+
+// Discard deletes the stage and anything left in it.
+func (stage *modpackStage) Discard() {
+	os.RemoveAll(stage.Path)
+}
+
+// commitModpack backs up the current mods, moves the staged files into the mcserver directory and
+// then points Settings at the modpack's versions.
+func (runner *McRunner) commitModpack(stage *modpackStage, mcver, loader, loaderver string) error {
+	_, err := GetLoader(loader)
+	if err != nil {
+		return err
+	}
+
+	backup, err := backupMods()
+	if err != nil {
+		return fmt.Errorf("backing up %s: %s", ModsDirectory, err)
+	}
+	if backup != "" {
+		fmt.Println(fmt.Sprintf("Moved the previous %s to %s", ModsDirectory, backup))
+	}
+	err = moveTree(stage.Path, McServerPath())
+	if err != nil {
+		return err
+	}
+	return runner.setModpackVersions(mcver, loader, loaderver)
+}
+
+// backupMods moves the current mods directory to a new directory under BackupDirectory so a
+// modpack's mods replace it rather than mixing with the previous pack's. It returns the backup's
+// path, or "" if there were no mods. Earlier backups are never overwritten.
+func backupMods() (string, error) {
+	modspath := filepath.Join(McServerPath(), ModsDirectory)
+	_, err := os.Stat(modspath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	stamp := "mods-" + time.Now().Format("20060102-150405")
+	backup := filepath.Join(BackupDirectory, stamp)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(McServerPath(), backup)); err != nil {
+			break
+		}
+		backup = filepath.Join(BackupDirectory, fmt.Sprintf("%s-%d", stamp, i))
+	}
+	err = os.MkdirAll(filepath.Join(McServerPath(), BackupDirectory), 0755)
+	if err != nil {
+		return "", err
+	}
+	return backup, os.Rename(modspath, filepath.Join(McServerPath(), backup))
+}
+
+// moveTree moves the files under src to the same places under dst, replacing files that exist.
+func moveTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == src {
+			return err
+		}
+		relpath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relpath)
+
+		if !info.IsDir() {
+			return os.Rename(path, target)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			// Merge into the existing directory.
+			return err
+		}
+		err = os.Rename(path, target)
+		if err != nil {
+			return err
+		}
+		return filepath.SkipDir
+	})
+}
+
+// safeJoin joins name onto dir, returning an error if the result would escape dir.
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if target != filepath.Clean(dir) && !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%s escapes %s", name, dir)
+	}
+	return target, nil
+}
+
+// extractZip extracts the entries of archive under prefix into dest, with prefix removed from their names.
+func extractZip(archive *zip.Reader, prefix, dest string) error {
+	for _, entry := range archive.File {
+		if !strings.HasPrefix(entry.Name, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(entry.Name, prefix)
+		if name == "" {
+			continue
+		}
+
+		target, err := safeJoin(dest, name)
+		if err != nil {
+			return err
+		}
+
+		if entry.FileInfo().IsDir() {
+			err = os.MkdirAll(target, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = extractZipFile(entry, target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipFile writes a single zip entry to target.
+func extractZipFile(entry *zip.File, target string) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	in, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// zipRoot returns the single top level directory, including its trailing slash, that every entry
+// of archive is inside of, or "" if there isn't one.
+func zipRoot(archive *zip.Reader) string {
+	root := ""
+	for _, entry := range archive.File {
+		index := strings.Index(entry.Name, "/")
+		if index < 0 {
+			return ""
+		}
+		if root == "" {
+			root = entry.Name[:index+1]
+		} else if root != entry.Name[:index+1] {
+			return ""
+		}
+	}
+	return root
+}
+
+// serverPackVersions returns the Minecraft version, loader and loader version of the server pack
+// archive, found from the Forge jars or libraries it includes. It returns empty versions with the
+// current loader if none are found.
+func serverPackVersions(archive *zip.Reader, loader string) (string, string, string) {
+	for _, entry := range archive.File {
+		name := entry.Name
+		if !strings.HasSuffix(name, "/") {
+			name = path.Base(name)
+		}
+		if match := serverPackForgeExp.FindStringSubmatch(name); match != nil {
+			return match[1], "forge", match[2]
+		}
+	}
+	return "", loader, ""
+}
+
+// findZipFile returns the entry with the given name, or nil.
+func findZipFile(archive *zip.Reader, name string) *zip.File {
+	for _, entry := range archive.File {
+		if entry.Name == name {
+			return entry
+		}
+	}
+	return nil
+}
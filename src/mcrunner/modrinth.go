@@ -0,0 +1,151 @@
+package mcrunner
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// ModrinthIndexFile name of the index at the root of a Modrinth .mrpack.
+const ModrinthIndexFile = "modrinth.index.json"
+
+// modrinthLoaders maps Modrinth dependency names to Loader names.
+var modrinthLoaders = map[string]string{
+	"forge":         "forge",
+	"fabric-loader": "fabric",
+	"quilt-loader":  "quilt",
+}
+
+// modrinthIndex is the modrinth.index.json at the root of a Modrinth .mrpack.
+type modrinthIndex struct {
+	FormatVersion int    `json:"formatVersion"`
+	Game          string `json:"game"`
+	VersionID     string `json:"versionId"`
+	Name          string `json:"name"`
+	Files         []struct {
+		Path   string            `json:"path"`
+		Hashes map[string]string `json:"hashes"`
+		Env    *struct {
+			Client string `json:"client"`
+			Server string `json:"server"`
+		} `json:"env"`
+		Downloads []string `json:"downloads"`
+		FileSize  int64    `json:"fileSize"`
+	} `json:"files"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// ImportModrinthPack imports a Modrinth .mrpack, downloading the files the server needs and
+// applying overrides followed by server-overrides. Every file must have a SHA512 or SHA1 hash to
+// be verified against.
+func (runner *McRunner) ImportModrinthPack(path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		fmt.Println("ImportModrinthPack: OpenReader:", err)
+		return err
+	}
+	defer archive.Close()
+
+	indexFile := findZipFile(&archive.Reader, ModrinthIndexFile)
+	if indexFile == nil {
+		return fmt.Errorf("ImportModrinthPack: %s has no %s", filepath.Base(path), ModrinthIndexFile)
+	}
+
+	reader, err := indexFile.Open()
+	if err != nil {
+		fmt.Println("ImportModrinthPack: opening index:", err)
+		return err
+	}
+	index := new(modrinthIndex)
+	err = json.NewDecoder(reader).Decode(index)
+	reader.Close()
+	if err != nil {
+		fmt.Println("ImportModrinthPack: parsing index:", err)
+		return err
+	}
+	if index.Game != "minecraft" {
+		return fmt.Errorf("ImportModrinthPack: unsupported game %q", index.Game)
+	}
+	fmt.Println(fmt.Sprintf("Importing Modrinth modpack %s %s", index.Name, index.VersionID))
+
+	if _, ok := index.Dependencies["neoforge"]; ok {
+		return fmt.Errorf("ImportModrinthPack: NeoForge packs aren't supported")
+	}
+	loader, loaderver := "vanilla", ""
+	for dependency, version := range index.Dependencies {
+		if name, ok := modrinthLoaders[dependency]; ok {
+			loader, loaderver = name, version
+		}
+	}
+	// Every file is checked before any is downloaded. LocalPath is relative until the stage is created.
+	var downloads []Download
+	var mirrors [][]string
+	for _, file := range index.Files {
+		if file.Env != nil && file.Env.Server == "unsupported" {
+			fmt.Println("Skipping client only file", file.Path)
+			continue
+		}
+
+		_, err := safeJoin(McServerPath(), file.Path)
+		if err != nil {
+			fmt.Println("ImportModrinthPack:", err)
+			return err
+		}
+		if len(file.Downloads) == 0 {
+			return fmt.Errorf("ImportModrinthPack: %s has no downloads", file.Path)
+		}
+
+		download := Download{LocalPath: file.Path}
+		if file.Hashes["sha512"] != "" {
+			download.Checksum = SHA512(file.Hashes["sha512"])
+		} else if file.Hashes["sha1"] != "" {
+			download.Checksum = SHA1(file.Hashes["sha1"])
+		} else {
+			return fmt.Errorf("ImportModrinthPack: %s has no sha512 or sha1 hash to verify it with", file.Path)
+		}
+		downloads = append(downloads, download)
+		mirrors = append(mirrors, file.Downloads)
+	}
+
+	stage, err := newModpackStage()
+	if err != nil {
+		fmt.Println("ImportModrinthPack: newModpackStage:", err)
+		return err
+	}
+	defer stage.Discard()
+
+	for i, download := range downloads {
+		download.LocalPath, err = safeJoin(stage.Path, download.LocalPath)
+		if err != nil {
+			return err
+		}
+
+		// Try each mirror the pack lists until one works.
+		for _, url := range mirrors[i] {
+			download.URL = url
+			err = runner.Download(download)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			fmt.Println("ImportModrinthPack: Download:", err)
+			return err
+		}
+	}
+
+	for _, overrides := range []string{"overrides/", "server-overrides/"} {
+		err = extractZip(&archive.Reader, overrides, stage.Path)
+		if err != nil {
+			fmt.Println("ImportModrinthPack: extracting", overrides, err)
+			return err
+		}
+	}
+
+	err = runner.commitModpack(stage, index.Dependencies["minecraft"], loader, loaderver)
+	if err != nil {
+		fmt.Println("ImportModrinthPack: commitModpack:", err)
+	}
+	return err
+}
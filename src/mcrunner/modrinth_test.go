@@ -0,0 +1,106 @@
+package mcrunner
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sha512Hex(s string) string {
+	sum := sha512.Sum512([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeModrinthPack writes a .mrpack with index, after replacing "{{base}}" with base, and files.
+func writeModrinthPack(t *testing.T, path, base, index string, files map[string]string) {
+	files[ModrinthIndexFile] = strings.Replace(index, "{{base}}", base, -1)
+	writeZip(t, path, files)
+}
+
+func TestImportModrinthPack(t *testing.T) {
+	dir := useTempRoot(t)
+	server := serveFiles(t, map[string]string{
+		"/server-mod.jar": "server mod",
+		"/both-mod.jar":   "both mod",
+	})
+	runner := &McRunner{}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pack := filepath.Join(dir, "pack.mrpack")
+	writeModrinthPack(t, pack, server.URL, `{
+		"formatVersion": 1,
+		"game": "minecraft",
+		"versionId": "1.0",
+		"name": "Test Pack",
+		"files": [
+			{"path": "mods/server-mod.jar", "hashes": {"sha1": "`+sha1Hex("server mod")+`", "sha512": "`+sha512Hex("server mod")+`"},
+				"env": {"client": "unsupported", "server": "required"}, "downloads": ["{{base}}/missing.jar", "{{base}}/server-mod.jar"]},
+			{"path": "mods/both-mod.jar", "hashes": {"sha1": "`+sha1Hex("both mod")+`"}, "downloads": ["{{base}}/both-mod.jar"]},
+			{"path": "mods/client-mod.jar", "hashes": {"sha1": "x", "sha512": "x"},
+				"env": {"client": "required", "server": "unsupported"}, "downloads": ["{{base}}/client-mod.jar"]}
+		],
+		"dependencies": {"minecraft": "1.20.1", "fabric-loader": "0.15.0"}
+	}`, map[string]string{
+		"overrides/config/shared.cfg":        "client",
+		"overrides/config/client.cfg":        "client only",
+		"server-overrides/config/shared.cfg": "server",
+		"client-overrides/config/ui.cfg":     "ui",
+	})
+
+	err = runner.ImportModpack(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"config/client.cfg", "config/shared.cfg", "mods/both-mod.jar", "mods/server-mod.jar", "pack.mrpack", SettingsFile}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %v, want %v", got, want)
+	}
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, "config", "shared.cfg"))
+	if string(contents) != "server" {
+		t.Errorf("server-overrides didn't replace overrides, shared.cfg is %q", contents)
+	}
+	settings := runner.Settings
+	if settings.MinecraftVersion != "1.20.1" || settings.Loader != "fabric" || settings.LoaderVersion != "0.15.0" {
+		t.Errorf("versions set to Minecraft %s with %s %s", settings.MinecraftVersion, settings.Loader, settings.LoaderVersion)
+	}
+}
+
+func TestImportModrinthPackErrors(t *testing.T) {
+	dir := useTempRoot(t)
+	server := serveFiles(t, map[string]string{"/mod.jar": "mod"})
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"escaping path", `{"path": "../mod.jar", "hashes": {"sha1": "` + sha1Hex("mod") + `"}, "downloads": ["{{base}}/mod.jar"]}`},
+		{"no hashes", `{"path": "mods/mod.jar", "hashes": {}, "downloads": ["{{base}}/mod.jar"]}`},
+		{"no downloads", `{"path": "mods/mod.jar", "hashes": {"sha1": "` + sha1Hex("mod") + `"}, "downloads": []}`},
+	}
+
+	for _, test := range tests {
+		pack := filepath.Join(dir, "pack.mrpack")
+		writeModrinthPack(t, pack, server.URL, `{"game": "minecraft", "files": [`+test.file+`],
+			"dependencies": {"minecraft": "1.20.1", "fabric-loader": "0.15.0"}}`, map[string]string{"overrides/config/a.cfg": "a"})
+		runner := &McRunner{}
+		err = runner.ImportModpack(pack)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if got := listFiles(t, dir); !reflect.DeepEqual(got, []string{"pack.mrpack"}) {
+			t.Errorf("%s: failed import left %v", test.name, got)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package mcrunner
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DisabledModsDirectory name of the directory inside the mcserver directory that disabled mods are moved to.
+const DisabledModsDirectory = "mods-disabled"
+
+// ModInfo describes a mod jar and the metadata read from it.
+type ModInfo struct {
+	File     string `json:"file"`
+	Disabled bool   `json:"disabled"`
+	Loader   string `json:"loader,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Version  string `json:"version,omitempty"`
+	// ClientOnly is set if the mod's metadata says it only runs on the client.
+	ClientOnly bool `json:"clientonly,omitempty"`
+}
+
+// mcmodInfo is an entry in the mcmod.info used by legacy Forge mods.
+type mcmodInfo struct {
+	ModID   string `json:"modid"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// fabricModJSON is the fabric.mod.json used by Fabric and Quilt mods.
+type fabricModJSON struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Environment string `json:"environment"`
+}
+
+// modsPath returns the directory mods live in, or disabled mods if disabled is true.
+func modsPath(disabled bool) string {
+	if disabled {
+		return filepath.Join(McServerPath(), DisabledModsDirectory)
+	}
+	return filepath.Join(McServerPath(), ModsDirectory)
+}
+
+// readZipEntry returns the contents of the named entry, or nil if there isn't one.
+func readZipEntry(archive *zip.Reader, name string) []byte {
+	entry := findZipFile(archive, name)
+	if entry == nil {
+		return nil
+	}
+
+	reader, err := entry.Open()
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil
+	}
+	return contents
+}
+
+// ReadModInfo reads the metadata of the mod jar at path from its mods.toml, fabric.mod.json or
+// mcmod.info. Jars without recognizable metadata only have File set.
+func ReadModInfo(path string) ModInfo {
+	info := ModInfo{File: filepath.Base(path)}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return info
+	}
+	defer archive.Close()
+
+	for _, name := range []string{"META-INF/mods.toml", "META-INF/neoforge.mods.toml"} {
+		contents := readZipEntry(&archive.Reader, name)
+		if contents == nil {
+			continue
+		}
+
+		toml, err := parseTOML(string(contents))
+		if err != nil {
+			continue
+		}
+		for _, mod := range tomlTables(toml, "mods") {
+			info.Loader = "forge"
+			info.ID = tomlString(mod, "modId")
+			info.Name = tomlString(mod, "displayName")
+			info.Version = tomlString(mod, "version")
+			if info.Version == "${file.jarVersion}" {
+				info.Version = manifestVersion(&archive.Reader)
+			}
+			info.ClientOnly = forgeClientOnly(toml)
+			return info
+		}
+	}
+
+	if contents := readZipEntry(&archive.Reader, "fabric.mod.json"); contents != nil {
+		fabric := new(fabricModJSON)
+		if json.Unmarshal(contents, fabric) == nil {
+			info.Loader = "fabric"
+			info.ID = fabric.ID
+			info.Name = fabric.Name
+			info.Version = fabric.Version
+			info.ClientOnly = fabric.Environment == "client"
+			return info
+		}
+	}
+
+	if contents := readZipEntry(&archive.Reader, "mcmod.info"); contents != nil {
+		// mcmod.info is either a bare list of mods, or version 2 with the list under modList.
+		var mods []mcmodInfo
+		if json.Unmarshal(contents, &mods) != nil {
+			var v2 struct {
+				ModList []mcmodInfo `json:"modList"`
+			}
+			json.Unmarshal(contents, &v2)
+			mods = v2.ModList
+		}
+		if len(mods) > 0 {
+			info.Loader = "forge"
+			info.ID = mods[0].ModID
+			info.Name = mods[0].Name
+			info.Version = mods[0].Version
+		}
+	}
+	return info
+}
+
+// forgeClientOnly returns true if a mods.toml sets clientSideOnly or only depends on Minecraft or
+// the loader on the client. displayTest isn't used: IGNORE_SERVER_VERSION marks mods only the
+// server needs, and IGNORE_ALL_VERSION is also set by mods that are merely optional on either side.
+func forgeClientOnly(toml map[string]interface{}) bool {
+	if clientSideOnly, _ := toml["clientSideOnly"].(bool); clientSideOnly {
+		return true
+	}
+
+	dependencies, _ := toml["dependencies"].(map[string]interface{})
+	for modid := range dependencies {
+		for _, dependency := range tomlTables(dependencies, modid) {
+			switch tomlString(dependency, "modId") {
+			case "minecraft", "forge", "neoforge":
+				if strings.EqualFold(tomlString(dependency, "side"), "CLIENT") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// manifestVersion returns the Implementation-Version from the jar's manifest.
+func manifestVersion(archive *zip.Reader) string {
+	contents := readZipEntry(archive, "META-INF/MANIFEST.MF")
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Implementation-Version:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Implementation-Version:"))
+		}
+	}
+	return ""
+}
+
+// ListMods returns the ModInfo of every installed mod jar, enabled or disabled.
+func ListMods() ([]ModInfo, error) {
+	mods := []ModInfo{}
+	for _, disabled := range []bool{false, true} {
+		files, err := ioutil.ReadDir(modsPath(disabled))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(strings.ToLower(file.Name()), ".jar") {
+				continue
+			}
+			info := ReadModInfo(filepath.Join(modsPath(disabled), file.Name()))
+			info.Disabled = disabled
+			mods = append(mods, info)
+		}
+	}
+
+	sort.Slice(mods, func(i, j int) bool { return strings.ToLower(mods[i].File) < strings.ToLower(mods[j].File) })
+	return mods, nil
+}
+
+// modFileName checks that name is a plain jar file name, so it can't be used to reach outside the mods directory.
+func modFileName(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, "/\\") || !strings.HasSuffix(strings.ToLower(name), ".jar") {
+		return "", fmt.Errorf("%q is not a jar file name", name)
+	}
+	return name, nil
+}
+
+// AddMod writes a mod jar into the mods directory, refusing anything that isn't a zip archive.
+func AddMod(name string, contents []byte) (ModInfo, error) {
+	name, err := modFileName(name)
+	if err != nil {
+		return ModInfo{}, err
+	}
+
+	_, err = zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return ModInfo{}, fmt.Errorf("%s is not a jar: %s", name, err)
+	}
+
+	err = os.MkdirAll(modsPath(false), 0755)
+	if err != nil {
+		return ModInfo{}, err
+	}
+
+	localpath := filepath.Join(modsPath(false), name)
+	err = ioutil.WriteFile(localpath+partialSuffix, contents, 0644)
+	if err != nil {
+		return ModInfo{}, err
+	}
+	err = os.Rename(localpath+partialSuffix, localpath)
+	if err != nil {
+		return ModInfo{}, err
+	}
+	return ReadModInfo(localpath), nil
+}
+
+// AddModFromURL downloads a mod jar into the mods directory.
+func (runner *McRunner) AddModFromURL(netpath string) (ModInfo, error) {
+	parsed, err := url.Parse(netpath)
+	if err != nil {
+		return ModInfo{}, err
+	}
+	name, err := modFileName(path.Base(parsed.Path))
+	if err != nil {
+		return ModInfo{}, err
+	}
+
+	localpath := filepath.Join(modsPath(false), name)
+	err = runner.downloadFile(localpath, netpath, false)
+	if err != nil {
+		return ModInfo{}, err
+	}
+
+	_, err = zip.OpenReader(localpath)
+	if err != nil {
+		os.Remove(localpath)
+		return ModInfo{}, fmt.Errorf("%s is not a jar: %s", name, err)
+	}
+	return ReadModInfo(localpath), nil
+}
+
+// RemoveMod deletes a mod jar, whether it is enabled or disabled.
+func RemoveMod(name string) error {
+	name, err := modFileName(name)
+	if err != nil {
+		return err
+	}
+
+	for _, disabled := range []bool{false, true} {
+		err = os.Remove(filepath.Join(modsPath(disabled), name))
+		if err == nil {
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("mod %s not found", name)
+}
+
+// SetModDisabled moves a mod jar between the mods and disabled mods directories.
+func SetModDisabled(name string, disabled bool) error {
+	name, err := modFileName(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(modsPath(disabled), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(filepath.Join(modsPath(!disabled), name), filepath.Join(modsPath(disabled), name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("mod %s not found in %s", name, filepath.Base(modsPath(!disabled)))
+	}
+	return err
+}
+
+// modsCommand handles "mods list", "mods add <url>", "mods add <file name>" with the jar as the
+// command's Data, "mods remove <file name>", "mods disable <file name>" and "mods enable <file name>".
+func (runner *McRunner) modsCommand(command *Command, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: mods list|add|remove|disable|enable")
+	}
+	if args[0] == "list" {
+		return ListMods()
+	}
+	if len(args) != 2 {
+		return nil, fmt.Errorf("usage: mods %s <file name>", args[0])
+	}
+
+	var data interface{}
+	var err error
+	switch args[0] {
+	case "add":
+		if len(command.Data) > 0 {
+			data, err = AddMod(args[1], command.Data)
+		} else {
+			data, err = runner.AddModFromURL(args[1])
+		}
+	case "remove":
+		err = RemoveMod(args[1])
+	case "disable":
+		err = SetModDisabled(args[1], true)
+	case "enable":
+		err = SetModDisabled(args[1], false)
+	default:
+		return nil, fmt.Errorf("unknown mods command %q", args[0])
+	}
+
+	if err == nil && command.Reboot {
+		runner.ScheduleReboot(RebootDelay)
+	}
+	return data, err
+}
@@ -0,0 +1,77 @@
+package mcrunner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadModInfoClientOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcrunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  bool
+	}{
+		{
+			name: "server only displayTest",
+			files: map[string]string{"META-INF/mods.toml": `modLoader = "javafml"
+[[mods]]
+modId = "backups"
+displayTest = "IGNORE_SERVER_VERSION"
+[[dependencies.backups]]
+modId = "forge"
+side = "BOTH"
+`},
+			want: false,
+		},
+		{
+			name: "optional displayTest",
+			files: map[string]string{"META-INF/neoforge.mods.toml": `modLoader = "javafml"
+displayTest = "IGNORE_ALL_VERSION"
+[[mods]]
+modId = "either"
+`},
+			want: false,
+		},
+		{
+			name: "client side dependency",
+			files: map[string]string{"META-INF/mods.toml": `modLoader = "javafml"
+[[mods]]
+modId = "minimap"
+[[dependencies.minimap]]
+modId = "minecraft"
+side = "CLIENT"
+`},
+			want: true,
+		},
+		{
+			name: "clientSideOnly",
+			files: map[string]string{"META-INF/mods.toml": `modLoader = "javafml"
+clientSideOnly = true
+[[mods]]
+modId = "shaders"
+`},
+			want: true,
+		},
+		{
+			name:  "fabric client environment",
+			files: map[string]string{"fabric.mod.json": `{"id": "zoom", "environment": "client"}`},
+			want:  true,
+		},
+	}
+
+	for i, test := range tests {
+		path := filepath.Join(dir, string(rune('a'+i))+".jar")
+		writeZip(t, path, test.files)
+		if got := ReadModInfo(path).ClientOnly; got != test.want {
+			t.Errorf("%s: ClientOnly is %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mcrunner
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PaperServerJar name the Paper server jar is installed as.
+	PaperServerJar = "paper.jar"
+	// DefaultPaperAPIURL is the Paper downloads API used when Settings doesn't name one.
+	DefaultPaperAPIURL = "https://api.papermc.io/v2"
+)
+
+// paperLogPatterns matches the output of Paper, which logs without a thread or logger name.
+var paperLogPatterns = &LogPatterns{
+	Message: regexp.MustCompile("^\\[[^\\]]* INFO\\]: (\\[Not Secure\\] )?<.*>"),
+	TPS:     regexp.MustCompile("^\\[[^\\]]* INFO\\]: .*TPS from last"),
+	Players: regexp.MustCompile("^\\[[^\\]]* INFO\\]: " + playersPattern),
+	Done:    regexp.MustCompile("^\\[[^\\]]* INFO\\]: Done"),
+}
+
+// formattingExp matches Minecraft formatting codes and ANSI escapes that Paper adds to its tps output.
+var formattingExp = regexp.MustCompile("§.|\x1b\\[[0-9;]*m")
+
+// paperBuild is the subset of the Paper API build response that is needed to download it.
+type paperBuild struct {
+	Build     int `json:"build"`
+	Downloads struct {
+		Application struct {
+			Name   string `json:"name"`
+			SHA256 string `json:"sha256"`
+		} `json:"application"`
+	} `json:"downloads"`
+}
+
+// PaperLoader installs and launches a Paper server, with LoaderVersion as the Paper build number.
+type PaperLoader struct{}
+
+// Name returns "paper".
+func (PaperLoader) Name() string {
+	return "paper"
+}
+
+// paperAPIURL returns the Paper API URL from Settings, or the default.
+func (runner *McRunner) paperAPIURL() string {
+	settings := runner.currentSettings()
+	if settings.PaperAPIURL != "" {
+		return strings.TrimSuffix(settings.PaperAPIURL, "/")
+	}
+	return DefaultPaperAPIURL
+}
+
+// Install downloads the Paper build in Settings from the Paper API.
+func (PaperLoader) Install(runner *McRunner) error {
+	settings := runner.currentSettings()
+	buildpath := fmt.Sprintf("%s/projects/paper/versions/%s/builds/%s", runner.paperAPIURL(), settings.MinecraftVersion, settings.LoaderVersion)
+	build := new(paperBuild)
+	err := runner.fetchJSON(buildpath, build)
+	if err != nil {
+		fmt.Println("PaperLoader.Install: fetching build:", err)
+		return err
+	}
+
+	jarname := build.Downloads.Application.Name
+	if jarname == "" {
+		jarname = fmt.Sprintf("paper-%s-%s.jar", settings.MinecraftVersion, settings.LoaderVersion)
+	}
+	download := Download{
+		LocalPath: filepath.Join(McServerPath(), PaperServerJar),
+		URL:       fmt.Sprintf("%s/downloads/%s", buildpath, jarname),
+		Checksum:  SHA256(build.Downloads.Application.SHA256),
+	}
+	err = runner.Download(download)
+	if err != nil {
+		fmt.Println("PaperLoader.Install: Download:", err)
+		return err
+	}
+	return nil
+}
+
+// LaunchTarget returns the Paper server jar.
+func (PaperLoader) LaunchTarget(mcver, loaderver string) string {
+	return PaperServerJar
+}
+
+// LaunchArgs runs the Paper server jar.
+func (PaperLoader) LaunchArgs(mcver, loaderver string) []string {
+	return []string{"-jar", PaperServerJar}
+}
+
+// InstalledFiles returns the Paper jar and the vanilla jar and libraries it patches on first launch.
+func (PaperLoader) InstalledFiles(info InstallInfo) []string {
+	return []string{PaperServerJar, "cache", "versions", "libraries"}
+}
+
+// TPSCommand returns "tps".
+func (PaperLoader) TPSCommand() string {
+	return "tps"
+}
+
+// ParseTPS parses "TPS from last 1m, 5m, 15m: 20.0, 20.0, 20.0", reporting the 1m average as the
+// overworld's TPS since Paper doesn't report TPS per dimension.
+func (PaperLoader) ParseTPS(line string) map[string]float32 {
+	line = formattingExp.ReplaceAllString(line, "")
+	index := strings.Index(line, "15m:")
+	if index < 0 {
+		return nil
+	}
+
+	numExp, _ := regexp.Compile("[0-9]*\\.?[0-9]+")
+	nums := numExp.FindAllString(line[index+len("15m:"):], -1)
+	if len(nums) == 0 {
+		return nil
+	}
+	tps, err := strconv.ParseFloat(nums[0], 32)
+	if err != nil {
+		return nil
+	}
+
+	m := make(map[string]float32)
+	m["0"] = float32(tps)
+	return m
+}
+
+// LogPatterns returns the Paper log patterns.
+func (PaperLoader) LogPatterns() *LogPatterns {
+	return paperLogPatterns
+}
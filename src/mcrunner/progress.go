@@ -0,0 +1,47 @@
+package mcrunner
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// ProgressInterval is the minimum time between progress messages for a single download.
+const ProgressInterval = 1 * time.Second
+
+// progress defines the structure of an install progress message to the Discord bot.
+type progress struct {
+	Step string `json:"step"`
+	// File is the file being downloaded, if any.
+	File string `json:"file,omitempty"`
+	// Bytes and Total are the bytes of File downloaded so far and its size, which is 0 if unknown.
+	Bytes int64  `json:"bytes,omitempty"`
+	Total int64  `json:"total,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// setInstallPhase records the step Install is on and reports it to the bot.
+func (runner *McRunner) setInstallPhase(step string) {
+	runner.installPhase = step
+	fmt.Println(step)
+	runner.respond("progress", progress{Step: step})
+}
+
+// installFailed reports the step Install failed on to the bot.
+func (runner *McRunner) installFailed(err error) {
+	runner.respond("progress", progress{Step: runner.installPhase, Error: err.Error()})
+}
+
+// downloadProgress returns a Download.Progress that reports downloading localpath to the bot
+// at most every ProgressInterval, and once it completes.
+func (runner *McRunner) downloadProgress(localpath string) func(bytes, total int64) {
+	file := filepath.Base(localpath)
+	var last time.Time
+	return func(bytes, total int64) {
+		if (total == 0 || bytes < total) && time.Since(last) < ProgressInterval {
+			return
+		}
+		last = time.Now()
+		runner.respond("progress", progress{Step: runner.installPhase, File: file, Bytes: bytes, Total: total})
+	}
+}
@@ -0,0 +1,252 @@
+package mcrunner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// PropertiesFile name of the server properties file inside the mcserver directory.
+const PropertiesFile = "server.properties"
+
+// propertyLine is a logical line of a properties file. Lines that aren't changed are written back
+// exactly as they were read, so comments, ordering and formatting survive.
+type propertyLine struct {
+	// raw is the text of the line, including any continuation lines, without the final newline.
+	raw string
+	// key is empty for comments and blank lines.
+	key   string
+	value string
+}
+
+// Properties is a Java properties file such as server.properties.
+type Properties struct {
+	lines []propertyLine
+}
+
+// PropertiesPath returns the path of server.properties.
+func PropertiesPath() string {
+	return filepath.Join(McServerPath(), PropertiesFile)
+}
+
+// ReadProperties reads the properties file at path. A missing file reads as empty.
+func ReadProperties(path string) (*Properties, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return new(Properties), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseProperties(string(contents)), nil
+}
+
+// ParseProperties parses the contents of a properties file.
+func ParseProperties(contents string) *Properties {
+	properties := new(Properties)
+	lines := strings.Split(strings.Replace(contents, "\r\n", "\n", -1), "\n")
+	// A trailing newline doesn't start another line.
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		raw := lines[i]
+		logical := strings.TrimLeft(raw, " \t\f")
+		if logical == "" || logical[0] == '#' || logical[0] == '!' {
+			properties.lines = append(properties.lines, propertyLine{raw: raw})
+			continue
+		}
+
+		// An odd number of trailing backslashes continues the line onto the next.
+		for continues(logical) && i+1 < len(lines) {
+			i++
+			raw += "\n" + lines[i]
+			logical = logical[:len(logical)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		key, value := splitProperty(logical)
+		properties.lines = append(properties.lines, propertyLine{raw: raw, key: key, value: value})
+	}
+	return properties
+}
+
+// continues returns true if line ends in an unescaped backslash.
+func continues(line string) bool {
+	count := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// splitProperty splits a logical line into its unescaped key and value. The key ends at the first
+// unescaped '=', ':' or whitespace.
+func splitProperty(line string) (string, string) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return unescapeProperty(line[:end]), unescapeProperty(rest)
+}
+
+// unescapeProperty resolves the backslash escapes in a key or value.
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			builder.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			builder.WriteByte('\t')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'u':
+			if i+5 <= len(s) {
+				if code, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					r := rune(code)
+					i += 4
+					// Characters outside the Basic Multilingual Plane are a pair of \u escapes.
+					if utf16.IsSurrogate(r) && i+7 <= len(s) && s[i+1:i+3] == "\\u" {
+						if low, err := strconv.ParseUint(s[i+3:i+7], 16, 16); err == nil {
+							if pair := utf16.DecodeRune(r, rune(low)); pair != unicode.ReplacementChar {
+								r = pair
+								i += 6
+							}
+						}
+					}
+					builder.WriteRune(r)
+					continue
+				}
+			}
+			builder.WriteByte('u')
+		default:
+			builder.WriteByte(s[i])
+		}
+	}
+	return builder.String()
+}
+
+// escapeProperty escapes a key or value the way Java's Properties.store does, so the file reads
+// the same whichever encoding the server loads it with.
+func escapeProperty(s string, isKey bool) string {
+	var builder strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			builder.WriteString("\\\\")
+		case r == '\t':
+			builder.WriteString("\\t")
+		case r == '\n':
+			builder.WriteString("\\n")
+		case r == '\r':
+			builder.WriteString("\\r")
+		case r == '\f':
+			builder.WriteString("\\f")
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case r == ' ' && (isKey || i == 0):
+			builder.WriteString("\\ ")
+		case r < 0x20 || r > 0x7e:
+			if r > 0xffff {
+				// Outside the Basic Multilingual Plane, written as a UTF-16 surrogate pair.
+				r -= 0x10000
+				builder.WriteString(fmt.Sprintf("\\u%04X\\u%04X", 0xd800+(r>>10), 0xdc00+(r&0x3ff)))
+			} else {
+				builder.WriteString(fmt.Sprintf("\\u%04X", r))
+			}
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// Get returns the value of key and whether it is set.
+func (properties *Properties) Get(key string) (string, bool) {
+	for _, line := range properties.lines {
+		if line.key == key {
+			return line.value, true
+		}
+	}
+	return "", false
+}
+
+// Set sets key to value, replacing the existing line in place or appending it if there is none.
+func (properties *Properties) Set(key, value string) {
+	line := propertyLine{raw: escapeProperty(key, true) + "=" + escapeProperty(value, false), key: key, value: value}
+	for i := range properties.lines {
+		if properties.lines[i].key == key {
+			if properties.lines[i].value != value {
+				properties.lines[i] = line
+			}
+			return
+		}
+	}
+	properties.lines = append(properties.lines, line)
+}
+
+// Map returns all the properties.
+func (properties *Properties) Map() map[string]string {
+	values := make(map[string]string)
+	for _, line := range properties.lines {
+		if line.key != "" {
+			values[line.key] = line.value
+		}
+	}
+	return values
+}
+
+// String returns the contents of the properties file.
+func (properties *Properties) String() string {
+	var builder strings.Builder
+	for _, line := range properties.lines {
+		builder.WriteString(line.raw)
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// Write writes the properties file to path.
+func (properties *Properties) Write(path string) error {
+	return ioutil.WriteFile(path, []byte(properties.String()), 0644)
+}
+
+// sortedKeys returns the keys of values in order, so appended properties are written consistently.
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
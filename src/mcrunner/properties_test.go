@@ -0,0 +1,85 @@
+package mcrunner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProperties(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     map[string]string
+	}{
+		{
+			name:     "separators",
+			contents: "a=1\nb = 2\nc:3\nd 4\ne\n  f=  padded\n",
+			want:     map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "", "f": "padded"},
+		},
+		{
+			name:     "comments and blank lines",
+			contents: "#Minecraft server properties\n! bang comment\n\n   \nmotd=hi # not a comment\n",
+			want:     map[string]string{"motd": "hi # not a comment"},
+		},
+		{
+			name:     "escapes",
+			contents: "key\\=with\\:separators=v\nmotd=\\u00A7aGreen \\u00e9\\ttab\nemoji=\\uD83D\\uDE00\npath=C\\:\\\\server\n",
+			want:     map[string]string{"key=with:separators": "v", "motd": "§aGreen é\ttab", "emoji": "😀", "path": "C:\\server"},
+		},
+		{
+			name:     "continuation lines",
+			contents: "long=one \\\n    two \\\n    three\nescaped=ends in backslash\\\\\nnext=1\n",
+			want:     map[string]string{"long": "one two three", "escaped": "ends in backslash\\", "next": "1"},
+		},
+		{
+			name:     "crlf",
+			contents: "a=1\r\nb=2\r\n",
+			want:     map[string]string{"a": "1", "b": "2"},
+		},
+	}
+
+	for _, test := range tests {
+		got := ParseProperties(test.contents).Map()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPropertiesPreservesUnchangedLines(t *testing.T) {
+	contents := "#Minecraft server properties\n#Mon Jan 01 00:00:00 UTC 2024\nmotd = \\u00A7aWelcome\nlong=one \\\n    two\n\nmax-players=20\n"
+	properties := ParseProperties(contents)
+	if got := properties.String(); got != contents {
+		t.Errorf("unchanged file written as %q, want %q", got, contents)
+	}
+
+	properties.Set("motd", "§aWelcome")
+	properties.Set("max-players", "10")
+	properties.Set("level-name", "world")
+	want := "#Minecraft server properties\n#Mon Jan 01 00:00:00 UTC 2024\nmotd = \\u00A7aWelcome\nlong=one \\\n    two\n\nmax-players=10\nlevel-name=world\n"
+	if got := properties.String(); got != want {
+		t.Errorf("edited file written as %q, want %q", got, want)
+	}
+}
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	values := map[string]string{
+		"plain":          "value",
+		"leading space":  "  padded",
+		"separators":     "a=b:c#d!e",
+		"control":        "tab\tnewline\ncr\rff\f",
+		"backslash":      "C:\\server\\",
+		"unicode":        "§aé 😀",
+		"key with=colon": "x",
+		"empty":          "",
+	}
+
+	properties := new(Properties)
+	for _, key := range sortedKeys(values) {
+		properties.Set(key, values[key])
+	}
+	got := ParseProperties(properties.String()).Map()
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("got %#v, want %#v", got, values)
+	}
+}
@@ -0,0 +1,86 @@
+package mcrunner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// QuarantineModsDirectory name of the directory inside the mcserver directory that client only mods are moved to.
+const QuarantineModsDirectory = "mods-quarantine"
+
+// quarantinedMod is a mod moved out of the mods directory before the server started.
+type quarantinedMod struct {
+	ModInfo
+	Reason string `json:"reason"`
+}
+
+// matchMod returns the entry in list matching the mod ID or, as a glob, the jar file name.
+func matchMod(mod ModInfo, list []string) (string, bool) {
+	for _, entry := range list {
+		if mod.ID != "" && strings.EqualFold(entry, mod.ID) {
+			return entry, true
+		}
+		if matched, _ := filepath.Match(strings.ToLower(entry), strings.ToLower(mod.File)); matched {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// clientOnlyReason returns why mod can't run on a dedicated server, or "" if it can.
+func (runner *McRunner) clientOnlyReason(mod ModInfo) string {
+	settings := runner.currentSettings()
+	if _, ok := matchMod(mod, settings.ServerMods); ok {
+		return ""
+	}
+	if entry, ok := matchMod(mod, settings.ClientOnlyMods); ok {
+		return fmt.Sprintf("matches %s in ClientOnlyMods", entry)
+	}
+
+	if mod.ClientOnly {
+		if mod.Loader == "fabric" {
+			return "fabric.mod.json environment is client"
+		}
+		return "mods.toml marks it as client side only"
+	}
+	return ""
+}
+
+// QuarantineClientMods moves the enabled mods that only run on the client into the quarantine
+// directory, returning the mods that were moved.
+func (runner *McRunner) QuarantineClientMods() ([]quarantinedMod, error) {
+	quarantined := []quarantinedMod{}
+	mods, err := ListMods()
+	if err != nil {
+		fmt.Println("QuarantineClientMods: ListMods:", err)
+		return quarantined, err
+	}
+
+	quarantinepath := filepath.Join(McServerPath(), QuarantineModsDirectory)
+	for _, mod := range mods {
+		if mod.Disabled {
+			continue
+		}
+		reason := runner.clientOnlyReason(mod)
+		if reason == "" {
+			continue
+		}
+
+		err = os.MkdirAll(quarantinepath, 0755)
+		if err != nil {
+			fmt.Println("QuarantineClientMods: MkdirAll:", err)
+			return quarantined, err
+		}
+		err = os.Rename(filepath.Join(modsPath(false), mod.File), filepath.Join(quarantinepath, mod.File))
+		if err != nil {
+			fmt.Println("QuarantineClientMods: Rename:", err)
+			return quarantined, err
+		}
+
+		fmt.Println(fmt.Sprintf("Quarantined client only mod %s: %s", mod.File, reason))
+		quarantined = append(quarantined, quarantinedMod{ModInfo: mod, Reason: reason})
+	}
+	return quarantined, nil
+}
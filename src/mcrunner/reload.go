@@ -0,0 +1,166 @@
+package mcrunner
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// SettingsPollInterval is how often the settings file is checked for changes.
+const SettingsPollInterval = 5 * time.Second
+
+// settingsChanges describes the fields that changed when the settings were reloaded.
+type settingsChanges struct {
+	// Applied fields took effect immediately.
+	Applied []string `json:"applied"`
+	// Restart fields take effect when the server is restarted.
+	Restart []string `json:"restart"`
+	// Wrapper fields take effect when mcrunner itself is restarted.
+	Wrapper []string `json:"wrapper"`
+	// RebootScheduled is set if a reboot was scheduled to apply the Restart fields.
+	RebootScheduled bool `json:"rebootscheduled"`
+}
+
+// diffSettings returns the fields that differ between old and new, by their reload tag.
+func diffSettings(old, new Settings) settingsChanges {
+	changes := settingsChanges{Applied: []string{}, Restart: []string{}, Wrapper: []string{}}
+	oldValue := reflect.ValueOf(old)
+	newValue := reflect.ValueOf(new)
+	settingsType := oldValue.Type()
+	for i := 0; i < settingsType.NumField(); i++ {
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+
+		field := settingsType.Field(i)
+		switch field.Tag.Get("reload") {
+		case "hot":
+			changes.Applied = append(changes.Applied, field.Name)
+		case "wrapper":
+			changes.Wrapper = append(changes.Wrapper, field.Name)
+		default:
+			changes.Restart = append(changes.Restart, field.Name)
+		}
+	}
+	return changes
+}
+
+// ReloadSettings reads and validates the settings file and replaces Settings with it, keeping the
+// current settings if it's invalid. Changes that need the server restarted take effect the next
+// time it starts, which is scheduled if reboot is set.
+func (runner *McRunner) ReloadSettings(reboot bool) (settingsChanges, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		fmt.Println("ReloadSettings: LoadSettings:", err)
+		return settingsChanges{}, err
+	}
+	err = settings.Validate()
+	if err != nil {
+		fmt.Println("ReloadSettings:", err)
+		return settingsChanges{}, err
+	}
+
+	previous, _ := runner.updateSettings(func(current *Settings) error {
+		*current = settings
+		return nil
+	})
+	changes := diffSettings(previous, settings)
+	for _, field := range changes.Applied {
+		fmt.Println(fmt.Sprintf("Reloaded %s", field))
+	}
+	if len(changes.Restart) > 0 {
+		fmt.Println(fmt.Sprintf("Settings changed that need a server restart: %v", changes.Restart))
+		if reboot && runner.state() != NotRunning {
+			runner.ScheduleReboot(RebootDelay)
+			changes.RebootScheduled = true
+		}
+	}
+	if len(changes.Wrapper) > 0 {
+		fmt.Println(fmt.Sprintf("Settings changed that need mcrunner restarted: %v", changes.Wrapper))
+	}
+	return changes, nil
+}
+
+// currentSettings returns a copy of Settings. Settings are always replaced whole, never changed in
+// place, so the copy stays consistent while they are replaced.
+func (runner *McRunner) currentSettings() Settings {
+	runner.settingsMutex.RLock()
+	defer runner.settingsMutex.RUnlock()
+	return runner.Settings
+}
+
+// replaceSettings replaces Settings while holding settingsMutex.
+func (runner *McRunner) replaceSettings(settings Settings) {
+	runner.settingsMutex.Lock()
+	runner.Settings = settings
+	runner.settingsMutex.Unlock()
+}
+
+// updateSettings calls update with a copy of Settings while holding settingsMutex, so no other
+// change is lost in between, and replaces Settings with the copy if it returns nil. It returns the
+// settings from before. update must not call currentSettings.
+func (runner *McRunner) updateSettings(update func(settings *Settings) error) (Settings, error) {
+	runner.settingsMutex.Lock()
+	defer runner.settingsMutex.Unlock()
+	previous := runner.Settings
+	settings := previous
+	err := update(&settings)
+	if err != nil {
+		return previous, err
+	}
+	runner.Settings = settings
+	return previous, nil
+}
+
+// settingsModTime returns the modification time of the settings file, or the zero time if it can't be read.
+func settingsModTime() time.Time {
+	info, err := os.Stat(SettingsPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// WatchSettings reloads the settings whenever the settings file changes or mcrunner receives
+// SIGHUP. Reloads go through CommandChannel like "settings reload" from the bot, so the bot is
+// sent the result. Changes to the file that match the current settings, such as those saved by
+// settings.set, are ignored.
+func (runner *McRunner) WatchSettings() {
+	runner.WaitGroup.Add(1)
+	defer runner.WaitGroup.Done()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	modTime := settingsModTime()
+	for {
+		select {
+		case <-hangup:
+			fmt.Println("Received SIGHUP, reloading settings")
+		case <-time.After(SettingsPollInterval):
+			current := settingsModTime()
+			if current.Equal(modTime) {
+				continue
+			}
+			modTime = current
+			if settings, err := LoadSettings(); err == nil && reflect.DeepEqual(settings, runner.currentSettings()) {
+				continue
+			}
+			fmt.Println(fmt.Sprintf("'%s' changed, reloading settings", SettingsFile))
+		}
+
+		modTime = settingsModTime()
+		runner.CommandChannel <- &Command{Command: "settings reload", Reboot: runner.currentSettings().RebootOnReload}
+	}
+}
+
+// settingsCommand handles "settings reload".
+func (runner *McRunner) settingsCommand(command *Command, args []string) (interface{}, error) {
+	if len(args) != 1 || args[0] != "reload" {
+		return nil, fmt.Errorf("usage: settings reload")
+	}
+	return runner.ReloadSettings(command.Reboot)
+}
@@ -0,0 +1,49 @@
+package mcrunner
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ResourcePackPath is the URL path the BotHandler serves Settings.ResourcePack at.
+const ResourcePackPath = "/resourcepack.zip"
+
+// resourcePack returns the URL players download Settings.ResourcePack from and its SHA1, which
+// clients use to tell whether their cached copy is current.
+func (runner *McRunner) resourcePack() (string, string, error) {
+	settings := runner.currentSettings()
+	if settings.PublicAddress == "" {
+		return "", "", fmt.Errorf("PublicAddress must be set for players to download ResourcePack")
+	}
+
+	file, err := os.Open(serverFilePath(settings.ResourcePack))
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", "", err
+	}
+
+	url := strings.TrimSuffix(settings.PublicAddress, "/") + ResourcePackPath
+	return url, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// serveResourcePack serves Settings.ResourcePack to players.
+func (runner *McRunner) serveResourcePack(w http.ResponseWriter, r *http.Request) {
+	resourcePack := runner.currentSettings().ResourcePack
+	if resourcePack == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeFile(w, r, serverFilePath(resourcePack))
+}
@@ -0,0 +1,244 @@
+package mcrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/mem"
+)
+
+// SettingsFile name of the settings file inside the mcserver directory.
+const SettingsFile = "settings.json"
+
+// LowestMaxRAM is the smallest MaxRAM, in megabytes, a server can be started with.
+const LowestMaxRAM = 512
+
+// SettingsPath returns the path of the settings file.
+func SettingsPath() string {
+	return filepath.Join(McServerPath(), SettingsFile)
+}
+
+// DefaultSettings returns the settings used for anything missing from the settings file.
+func DefaultSettings() Settings {
+	return Settings{Directory: "./", Name: "?", MOTD: "?", MaxRAM: 6192, MinRAM: 512, MaxPlayers: 20, Port: 25565, ListenAddress: ":8080", PassthroughStdErr: true, PassthroughStdOut: false, Loader: "forge", MinecraftVersion: "1.12.2", LoaderVersion: "14.23.5.2836", LaunchWrapperVersion: "1.12", StatusInterval: 60, BackupsKept: 5}
+}
+
+// SaveSettings writes settings to the settings file. Fields overridden by the environment or flags
+// keep the value already in the file, and changing them is an error.
+func SaveSettings(settings Settings) error {
+	if len(overrides) > 0 {
+		err := checkOverrides(settings)
+		if err != nil {
+			return err
+		}
+		file, err := loadSettingsFile()
+		if err != nil {
+			return err
+		}
+		settings = withoutOverrides(settings, file)
+	}
+	return writeSettingsFile(settings)
+}
+
+// writeSettingsFile writes settings to the settings file as they are.
+func writeSettingsFile(settings Settings) error {
+	settingsJSON, err := json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(SettingsPath(), settingsJSON, 0644)
+}
+
+// LoadSettings reads the settings file over DefaultSettings, so fields missing from it keep their
+// defaults, then applies the overrides from ConfigureOverrides. A missing file is created with the
+// defaults. Malformed JSON, fields of the wrong type and unknown fields, which are usually typos,
+// are errors.
+func LoadSettings() (Settings, error) {
+	settings, err := loadSettingsFile()
+	if os.IsNotExist(err) {
+		fmt.Println(fmt.Sprintf("'%s' not found, generating default file.", SettingsFile))
+		settings = DefaultSettings()
+		err = writeSettingsFile(settings)
+		if err != nil {
+			fmt.Println("LoadSettings: writeSettingsFile:", err)
+		}
+	} else if err != nil {
+		return settings, err
+	}
+
+	err = applyOverrides(&settings)
+	return settings, err
+}
+
+// loadSettingsFile reads the settings file over DefaultSettings without the overrides.
+func loadSettingsFile() (Settings, error) {
+	settings := DefaultSettings()
+	contents, err := ioutil.ReadFile(SettingsPath())
+	if err != nil {
+		return settings, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&settings)
+	if err != nil {
+		return settings, fmt.Errorf("%s: %s", SettingsFile, describeJSONError(contents, err))
+	}
+	return settings, nil
+}
+
+// describeJSONError adds the line and column to JSON syntax and type errors.
+func describeJSONError(contents []byte, err error) string {
+	var offset int64
+	switch jsonErr := err.(type) {
+	case *json.SyntaxError:
+		offset = jsonErr.Offset
+	case *json.UnmarshalTypeError:
+		offset = jsonErr.Offset
+		if jsonErr.Field != "" {
+			err = fmt.Errorf("%s must be of type %s, not %s", jsonErr.Field, jsonErr.Type, jsonErr.Value)
+		}
+	default:
+		return err.Error()
+	}
+
+	if offset > int64(len(contents)) {
+		offset = int64(len(contents))
+	}
+	before := contents[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d, column %d: %s", line, column, err)
+}
+
+// SettingsErrors lists everything wrong with a Settings.
+type SettingsErrors []string
+
+func (errs SettingsErrors) Error() string {
+	return "invalid settings:\n  " + strings.Join(errs, "\n  ")
+}
+
+// validPort returns an error message if port isn't a TCP port number.
+func validPort(name string, port int) string {
+	if port < 1 || port > 65535 {
+		return fmt.Sprintf("%s %d must be between 1 and 65535", name, port)
+	}
+	return ""
+}
+
+// installsOffline returns true if the loader called name installs mcver entirely through Download,
+// so it can be installed from the cache. The Forge 1.13+ and Quilt installers and the Fabric and
+// Paper launchers fetch the vanilla jar and libraries themselves.
+func installsOffline(name, mcver string) bool {
+	switch name {
+	case "vanilla":
+		return true
+	case "forge":
+		return GetForgeGeneration(mcver) == ForgeLegacy
+	}
+	return false
+}
+
+// Validate checks the settings, returning a SettingsErrors describing every problem found.
+func (settings Settings) Validate() error {
+	var errs SettingsErrors
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if msg := validPort("Port", settings.Port); msg != "" {
+		add("%s", msg)
+	}
+	if settings.MaxPlayers < 1 {
+		add("MaxPlayers %d must be at least 1", settings.MaxPlayers)
+	}
+	if settings.StatusInterval < 1 {
+		add("StatusInterval %d must be at least 1 second", settings.StatusInterval)
+	}
+	if settings.BackupsKept < 0 {
+		add("BackupsKept %d can't be negative", settings.BackupsKept)
+	}
+
+	if settings.MaxRAM < LowestMaxRAM {
+		add("MaxRAM %d must be at least %d megabytes", settings.MaxRAM, LowestMaxRAM)
+	} else if memory, err := mem.VirtualMemory(); err == nil && memory.Total > 0 {
+		total := int(memory.Total / (1024 * 1024))
+		if settings.MaxRAM > total {
+			add("MaxRAM %d is more than the %d megabytes this host has", settings.MaxRAM, total)
+		}
+	}
+	errs = append(errs, settings.validateJVM()...)
+
+	_, portStr, err := net.SplitHostPort(settings.ListenAddress)
+	if err != nil {
+		add("ListenAddress %q must be host:port or :port: %s", settings.ListenAddress, err)
+	} else if port, err := strconv.Atoi(portStr); err != nil {
+		add("ListenAddress %q has an invalid port", settings.ListenAddress)
+	} else if msg := validPort("ListenAddress port", port); msg != "" {
+		add("%s", msg)
+	} else if port == settings.Port {
+		add("ListenAddress port %d is the same as the Minecraft server Port", port)
+	}
+
+	loader, err := GetLoader(settings.Loader)
+	if err != nil {
+		add("Loader: %s", err)
+	}
+	if settings.MinecraftVersion == "" {
+		add("MinecraftVersion must be set")
+	}
+	if loader != nil && loader.Name() != "vanilla" && settings.LoaderVersion == "" {
+		add("LoaderVersion must be set for %s", loader.Name())
+	}
+
+	// Modpack isn't checked, it only needs to exist until it has been imported.
+	for _, path := range []struct{ name, path string }{
+		{"ServerIcon", settings.ServerIcon},
+		{"ResourcePack", settings.ResourcePack},
+	} {
+		if path.path == "" {
+			continue
+		}
+		if _, err := os.Stat(serverFilePath(path.path)); err != nil {
+			add("%s: %s", path.name, err)
+		}
+	}
+	for _, path := range settings.JavaPaths {
+		if _, err := os.Stat(path); err != nil {
+			add("JavaPaths: %s", err)
+		}
+	}
+
+	if settings.ResourcePack != "" && settings.PublicAddress == "" {
+		add("PublicAddress must be set for players to download ResourcePack")
+	}
+	if settings.PublicAddress != "" {
+		if parsed, err := url.Parse(settings.PublicAddress); err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			add("PublicAddress %q must be an http or https URL", settings.PublicAddress)
+		}
+	}
+	if settings.Offline && settings.CacheDirectory == "" {
+		add("Offline needs CacheDirectory to install from")
+	}
+	if settings.Offline && loader != nil && !installsOffline(loader.Name(), settings.MinecraftVersion) {
+		add("Offline can't install %s %s, its installer downloads files the cache doesn't hold", loader.Name(), settings.MinecraftVersion)
+	}
+	for prefix, mirror := range settings.Mirrors {
+		if parsed, err := url.Parse(mirror); err != nil || parsed.Host == "" {
+			add("Mirrors: %q for %s is not a URL", mirror, prefix)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package mcrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SecretMask replaces the value of Settings fields tagged secret:"true" in settings.get responses.
+const SecretMask = "********"
+
+// ownedProperties are the server.properties keys applySettings sets from a Settings field, which
+// would override anything set for them in Settings.Properties.
+var ownedProperties = map[string]string{
+	"displayname":        "Name",
+	"motd":               "MOTD",
+	"max-players":        "MaxPlayers",
+	"server-port":        "Port",
+	"resource-pack":      "ResourcePack",
+	"resource-pack-sha1": "ResourcePack",
+}
+
+// SettingsRequest is a settings.get or settings.set message from the Discord bot.
+type SettingsRequest struct {
+	// Set is true for settings.set.
+	Set bool `json:"-"`
+	// Settings lists the Settings fields to get, or maps them to their new values for settings.set.
+	Settings json.RawMessage `json:"settings,omitempty"`
+	// Properties lists the server.properties keys to get, or maps them to their new values for settings.set.
+	Properties json.RawMessage `json:"properties,omitempty"`
+	// Reboot schedules a reboot if settings.set changed something that needs one to take effect.
+	Reboot bool `json:"reboot,omitempty"`
+}
+
+// settingsResult is the reply to a SettingsRequest, sent as a "settings" message.
+type settingsResult struct {
+	// Type is "settings.get" or "settings.set".
+	Type    string `json:"type"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Settings and Properties hold the requested values, or every value if none were named. For
+	// settings.set they are the values after the change.
+	Settings   map[string]interface{} `json:"settings,omitempty"`
+	Properties map[string]string      `json:"properties,omitempty"`
+	// The changes made by settings.set.
+	*settingsChanges
+}
+
+// settingsField returns the name of the Settings field called name, ignoring case.
+func settingsField(name string) (string, error) {
+	settingsType := reflect.TypeOf(Settings{})
+	for i := 0; i < settingsType.NumField(); i++ {
+		if strings.EqualFold(settingsType.Field(i).Name, name) {
+			return settingsType.Field(i).Name, nil
+		}
+	}
+	return "", fmt.Errorf("there is no setting called %q", name)
+}
+
+// settingsValues returns the named fields of settings, or all of them if names is empty.
+func settingsValues(settings Settings, names []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	settingsValue := reflect.ValueOf(settings)
+	settingsType := settingsValue.Type()
+	for i := 0; i < settingsType.NumField(); i++ {
+		field := settingsType.Field(i)
+		values[field.Name] = settingsValue.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" && settingsValue.Field(i).String() != "" {
+			values[field.Name] = SecretMask
+		}
+	}
+	if len(names) == 0 {
+		return values, nil
+	}
+
+	selected := make(map[string]interface{})
+	for _, name := range names {
+		field, err := settingsField(name)
+		if err != nil {
+			return nil, err
+		}
+		selected[field] = values[field]
+	}
+	return selected, nil
+}
+
+// propertyValues returns the named server.properties keys, or all of them if keys is empty. Values
+// set in Settings.Properties are returned even if they haven't been written to server.properties yet.
+func (runner *McRunner) propertyValues(keys []string) (map[string]string, error) {
+	props, err := ReadProperties(PropertiesPath())
+	if err != nil {
+		return nil, err
+	}
+	values := props.Map()
+	for key, value := range runner.currentSettings().Properties {
+		values[key] = value
+	}
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	selected := make(map[string]string)
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			selected[key] = value
+		}
+	}
+	return selected, nil
+}
+
+// getSettings handles settings.get.
+func (runner *McRunner) getSettings(request *SettingsRequest) (*settingsResult, error) {
+	var names, keys []string
+	if len(request.Settings) > 0 {
+		err := json.Unmarshal(request.Settings, &names)
+		if err != nil {
+			return nil, fmt.Errorf("settings must be a list of setting names: %s", err)
+		}
+	}
+	if len(request.Properties) > 0 {
+		err := json.Unmarshal(request.Properties, &keys)
+		if err != nil {
+			return nil, fmt.Errorf("properties must be a list of server.properties keys: %s", err)
+		}
+	}
+
+	result := &settingsResult{Type: "settings.get"}
+	var err error
+	result.Settings, err = settingsValues(runner.currentSettings(), names)
+	if err != nil {
+		return nil, err
+	}
+	result.Properties, err = runner.propertyValues(keys)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetSettings changes the named Settings fields and server.properties keys, which are kept in
+// Settings.Properties so they survive the server rewriting server.properties. The new settings are
+// validated and saved to settings.json before they replace the current ones.
+func (runner *McRunner) SetSettings(fields map[string]json.RawMessage, properties map[string]string, reboot bool) (*settingsChanges, error) {
+	if runner.upgradeInProgress() {
+		return nil, errUpgrading
+	}
+	var settings Settings
+	previous, err := runner.updateSettings(func(current *Settings) error {
+		settingsValue := reflect.ValueOf(current).Elem()
+		for name, value := range fields {
+			field, err := settingsField(name)
+			if err != nil {
+				return err
+			}
+			// Zeroed first so maps and slices are replaced rather than merged into the current settings.
+			fieldValue := settingsValue.FieldByName(field)
+			fieldValue.Set(reflect.Zero(fieldValue.Type()))
+			err = json.Unmarshal(value, fieldValue.Addr().Interface())
+			if err != nil {
+				return fmt.Errorf("%s: %s", field, err)
+			}
+		}
+
+		if len(properties) > 0 {
+			merged := make(map[string]string)
+			for key, value := range current.Properties {
+				merged[key] = value
+			}
+			for key, value := range properties {
+				if field, ok := ownedProperties[key]; ok {
+					return fmt.Errorf("%s is set from the %s setting", key, field)
+				}
+				if key == "" {
+					return fmt.Errorf("server.properties keys can't be empty")
+				}
+				merged[key] = value
+			}
+			current.Properties = merged
+		}
+
+		err := current.Validate()
+		if err != nil {
+			return err
+		}
+		err = SaveSettings(*current)
+		if err != nil {
+			fmt.Println("SetSettings: SaveSettings:", err)
+			return err
+		}
+		settings = *current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffSettings(previous, settings)
+	if len(changes.Restart) > 0 && reboot && runner.state() != NotRunning {
+		runner.ScheduleReboot(RebootDelay)
+		changes.RebootScheduled = true
+	}
+	return &changes, nil
+}
+
+// setSettings handles settings.set.
+func (runner *McRunner) setSettings(request *SettingsRequest) (*settingsResult, error) {
+	var fields map[string]json.RawMessage
+	var properties map[string]string
+	if len(request.Settings) > 0 {
+		err := json.Unmarshal(request.Settings, &fields)
+		if err != nil {
+			return nil, fmt.Errorf("settings must map setting names to their values: %s", err)
+		}
+	}
+	if len(request.Properties) > 0 {
+		err := json.Unmarshal(request.Properties, &properties)
+		if err != nil {
+			return nil, fmt.Errorf("properties must map server.properties keys to string values: %s", err)
+		}
+	}
+	if len(fields) == 0 && len(properties) == 0 {
+		return nil, fmt.Errorf("settings.set needs settings or properties to change")
+	}
+
+	changes, err := runner.SetSettings(fields, properties, request.Reboot)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &settingsResult{Type: "settings.set", settingsChanges: changes}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	if len(names) > 0 {
+		result.Settings, _ = settingsValues(runner.currentSettings(), names)
+	}
+	if len(keys) > 0 {
+		result.Properties, _ = runner.propertyValues(keys)
+	}
+	return result, nil
+}
+
+// handleSettingsRequest answers a settings.get or settings.set message with a "settings" message.
+func (runner *McRunner) handleSettingsRequest(request *SettingsRequest) {
+	handle, requestType := runner.getSettings, "settings.get"
+	if request.Set {
+		handle, requestType = runner.setSettings, "settings.set"
+	}
+
+	result, err := handle(request)
+	if err != nil {
+		fmt.Println(fmt.Sprintf("%s:", requestType), err)
+		result = &settingsResult{Type: requestType, Error: err.Error()}
+	} else {
+		result.Success = true
+	}
+	runner.respond("settings", result)
+}
@@ -0,0 +1,39 @@
+package mcrunner
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSetSettingsConcurrently(t *testing.T) {
+	dir := useTempRoot(t)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &McRunner{Settings: DefaultSettings()}
+
+	// Each change is made to the settings left by the ones before it, so none are lost.
+	var wait sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			_, err := runner.SetSettings(nil, map[string]string{"key-" + strconv.Itoa(i): "value"}, false)
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wait.Wait()
+
+	if properties := runner.currentSettings().Properties; len(properties) != 8 {
+		t.Errorf("kept %v, want all 8 properties", properties)
+	}
+	saved, err := loadSettingsFile()
+	if err != nil || len(saved.Properties) != 8 {
+		t.Errorf("saved %v, %v", saved.Properties, err)
+	}
+}
@@ -0,0 +1,445 @@
+package mcrunner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the subset of TOML used by mod metadata and config files into nested maps.
+// Tables are map[string]interface{}, arrays and arrays of tables are []interface{}, and values are
+// string, bool, int64 or float64. Dates and other values are kept as their raw text.
+func parseTOML(data string) (map[string]interface{}, error) {
+	parser := &tomlParser{data: data, line: 1}
+	root := make(map[string]interface{})
+	current := root
+
+	for {
+		parser.skipBlank()
+		if parser.eof() {
+			return root, nil
+		}
+
+		var err error
+		if parser.peek() == '[' {
+			current, err = parser.parseHeader(root)
+		} else {
+			err = parser.parseKeyValue(current)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", parser.line, err)
+		}
+
+		parser.skipSpace()
+		parser.skipComment()
+		if !parser.eof() && parser.peek() != '\n' && parser.peek() != '\r' {
+			return nil, fmt.Errorf("line %d: unexpected %q", parser.line, parser.peek())
+		}
+	}
+}
+
+// tomlParser holds the position in the document being parsed.
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (parser *tomlParser) eof() bool {
+	return parser.pos >= len(parser.data)
+}
+
+func (parser *tomlParser) peek() byte {
+	return parser.data[parser.pos]
+}
+
+func (parser *tomlParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(parser.data[parser.pos:], prefix)
+}
+
+// skipSpace skips spaces and tabs.
+func (parser *tomlParser) skipSpace() {
+	for !parser.eof() && (parser.peek() == ' ' || parser.peek() == '\t') {
+		parser.pos++
+	}
+}
+
+// skipComment skips a comment up to, but not including, the end of the line.
+func (parser *tomlParser) skipComment() {
+	if parser.eof() || parser.peek() != '#' {
+		return
+	}
+	for !parser.eof() && parser.peek() != '\n' {
+		parser.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments.
+func (parser *tomlParser) skipBlank() {
+	for !parser.eof() {
+		switch parser.peek() {
+		case '\n':
+			parser.line++
+			parser.pos++
+		case ' ', '\t', '\r':
+			parser.pos++
+		case '#':
+			parser.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// parseHeader parses a [table] or [[array.of.tables]] header, returning the table it opens.
+func (parser *tomlParser) parseHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	array := parser.hasPrefix("[[")
+	if array {
+		parser.pos += 2
+	} else {
+		parser.pos++
+	}
+
+	keys, err := parser.parseKey()
+	if err != nil {
+		return nil, err
+	}
+
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	parser.skipSpace()
+	if !parser.hasPrefix(closing) {
+		return nil, fmt.Errorf("expected %s", closing)
+	}
+	parser.pos += len(closing)
+
+	parent, err := tomlTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+
+	if array {
+		table := make(map[string]interface{})
+		existing, _ := parent[last].([]interface{})
+		parent[last] = append(existing, table)
+		return table, nil
+	}
+	return tomlTable(parent, []string{last})
+}
+
+// tomlTable walks keys from table, creating tables that don't exist. An array of tables
+// resolves to its last element, as in TOML.
+func tomlTable(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch value := table[key].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			table[key] = next
+			table = next
+		case map[string]interface{}:
+			table = value
+		case []interface{}:
+			if len(value) == 0 {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			next, ok := value[len(value)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			table = next
+		default:
+			return nil, fmt.Errorf("%s is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// parseKey parses a bare, quoted or dotted key into its parts.
+func (parser *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		parser.skipSpace()
+		if parser.eof() {
+			return nil, fmt.Errorf("expected key")
+		}
+
+		switch parser.peek() {
+		case '"', '\'':
+			key, err := parser.parseString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		default:
+			start := parser.pos
+			for !parser.eof() && isBareKeyChar(parser.peek()) {
+				parser.pos++
+			}
+			if start == parser.pos {
+				return nil, fmt.Errorf("expected key, found %q", parser.peek())
+			}
+			keys = append(keys, parser.data[start:parser.pos])
+		}
+
+		parser.skipSpace()
+		if parser.eof() || parser.peek() != '.' {
+			return keys, nil
+		}
+		parser.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+// parseKeyValue parses "key = value" into table.
+func (parser *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := parser.parseKey()
+	if err != nil {
+		return err
+	}
+
+	parser.skipSpace()
+	if parser.eof() || parser.peek() != '=' {
+		return fmt.Errorf("expected = after %s", strings.Join(keys, "."))
+	}
+	parser.pos++
+	parser.skipSpace()
+
+	value, err := parser.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent, err := tomlTable(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	parent[keys[len(keys)-1]] = value
+	return nil
+}
+
+// parseValue parses any value.
+func (parser *tomlParser) parseValue() (interface{}, error) {
+	if parser.eof() {
+		return nil, fmt.Errorf("expected value")
+	}
+
+	switch parser.peek() {
+	case '"', '\'':
+		return parser.parseString()
+	case '[':
+		return parser.parseArray()
+	case '{':
+		return parser.parseInlineTable()
+	}
+
+	start := parser.pos
+	for !parser.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(parser.peek())) {
+		parser.pos++
+	}
+	raw := parser.data[start:parser.pos]
+	switch raw {
+	case "":
+		return nil, fmt.Errorf("expected value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	number := strings.Replace(raw, "_", "", -1)
+	if i, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	return raw, nil
+}
+
+// parseArray parses an array, which may span several lines.
+func (parser *tomlParser) parseArray() (interface{}, error) {
+	parser.pos++
+	array := []interface{}{}
+	for {
+		parser.skipBlank()
+		if parser.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if parser.peek() == ']' {
+			parser.pos++
+			return array, nil
+		}
+
+		value, err := parser.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+
+		parser.skipBlank()
+		if !parser.eof() && parser.peek() == ',' {
+			parser.pos++
+		}
+	}
+}
+
+// parseInlineTable parses an inline table.
+func (parser *tomlParser) parseInlineTable() (interface{}, error) {
+	parser.pos++
+	table := make(map[string]interface{})
+	for {
+		parser.skipSpace()
+		if parser.eof() {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		if parser.peek() == '}' {
+			parser.pos++
+			return table, nil
+		}
+
+		err := parser.parseKeyValue(table)
+		if err != nil {
+			return nil, err
+		}
+
+		parser.skipSpace()
+		if !parser.eof() && parser.peek() == ',' {
+			parser.pos++
+		}
+	}
+}
+
+// parseString parses a basic, literal, or multi-line string.
+func (parser *tomlParser) parseString() (string, error) {
+	quote := parser.data[parser.pos : parser.pos+1]
+	multiline := parser.hasPrefix(strings.Repeat(quote, 3))
+	if multiline {
+		quote = strings.Repeat(quote, 3)
+	}
+	parser.pos += len(quote)
+	literal := quote[0] == '\''
+
+	// A newline immediately following the opening delimiter is trimmed.
+	if multiline && parser.hasPrefix("\r\n") {
+		parser.pos += 2
+		parser.line++
+	} else if multiline && parser.hasPrefix("\n") {
+		parser.pos++
+		parser.line++
+	}
+
+	var builder strings.Builder
+	for {
+		if parser.eof() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if parser.hasPrefix(quote) {
+			parser.pos += len(quote)
+			return builder.String(), nil
+		}
+
+		c := parser.peek()
+		if c == '\n' {
+			if !multiline {
+				return "", fmt.Errorf("newline in string")
+			}
+			parser.line++
+		}
+
+		if c == '\\' && !literal {
+			err := parser.parseEscape(&builder, multiline)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		builder.WriteByte(c)
+		parser.pos++
+	}
+}
+
+// parseEscape parses a backslash escape in a basic string.
+func (parser *tomlParser) parseEscape(builder *strings.Builder, multiline bool) error {
+	parser.pos++
+	if parser.eof() {
+		return fmt.Errorf("unterminated escape")
+	}
+
+	c := parser.peek()
+	parser.pos++
+	switch c {
+	case 'b':
+		builder.WriteByte('\b')
+	case 't':
+		builder.WriteByte('\t')
+	case 'n':
+		builder.WriteByte('\n')
+	case 'f':
+		builder.WriteByte('\f')
+	case 'r':
+		builder.WriteByte('\r')
+	case '"', '\\':
+		builder.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if parser.pos+size > len(parser.data) {
+			return fmt.Errorf("short unicode escape")
+		}
+		code, err := strconv.ParseUint(parser.data[parser.pos:parser.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		builder.WriteRune(rune(code))
+		parser.pos += size
+	default:
+		if !multiline || !strings.ContainsRune(" \t\r\n", rune(c)) {
+			return fmt.Errorf("invalid escape \\%c", c)
+		}
+		// A backslash at the end of a line trims the newline and leading whitespace that follows.
+		parser.pos--
+		for !parser.eof() && strings.ContainsRune(" \t\r\n", rune(parser.peek())) {
+			if parser.peek() == '\n' {
+				parser.line++
+			}
+			parser.pos++
+		}
+	}
+	return nil
+}
+
+// tomlString returns the string at the dotted key path in table, or "".
+func tomlString(table map[string]interface{}, path string) string {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := table[key].(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		table = next
+	}
+	value, _ := table[keys[len(keys)-1]].(string)
+	return value
+}
+
+// tomlTables returns the array of tables at key in table.
+func tomlTables(table map[string]interface{}, key string) []map[string]interface{} {
+	array, _ := table[key].([]interface{})
+	tables := make([]map[string]interface{}, 0, len(array))
+	for _, value := range array {
+		if t, ok := value.(map[string]interface{}); ok {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
@@ -0,0 +1,112 @@
+package mcrunner
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]interface{}
+	}{
+		{
+			name: "values",
+			data: "s = \"text\" # comment\ni = 1_000\nh = 0xff\nf = 1.5\nb = true\nd = 1979-05-27\n",
+			want: map[string]interface{}{"s": "text", "i": int64(1000), "h": int64(255), "f": 1.5, "b": true, "d": "1979-05-27"},
+		},
+		{
+			name: "strings",
+			data: "basic = \"a 'b'\"\nliteral = 'C:\\path\\'\nmulti = \"\"\"\nline one\nline two\"\"\"\nmultiliteral = '''\n\\n stays'''\n",
+			want: map[string]interface{}{"basic": "a 'b'", "literal": "C:\\path\\", "multi": "line one\nline two", "multiliteral": "\\n stays"},
+		},
+		{
+			name: "escapes",
+			data: "e = \"tab\\tquote\\\"slash\\\\nl\\n\"\nu = \"\\u00e9\\U0001F600\"\ntrim = \"\"\"a \\\n    b\"\"\"\n",
+			want: map[string]interface{}{"e": "tab\tquote\"slash\\nl\n", "u": "é😀", "trim": "a b"},
+		},
+		{
+			name: "dotted keys",
+			data: "a.b = 1\n\"quoted.key\" = 2\n[x.y]\nz.w = 3\n",
+			want: map[string]interface{}{
+				"a":          map[string]interface{}{"b": int64(1)},
+				"quoted.key": int64(2),
+				"x":          map[string]interface{}{"y": map[string]interface{}{"z": map[string]interface{}{"w": int64(3)}}},
+			},
+		},
+		{
+			name: "arrays of tables",
+			data: "modLoader = \"javafml\"\n[[mods]]\nmodId = \"one\"\n[[mods]]\nmodId = \"two\"\n[[dependencies.two]]\nmodId = \"forge\"\n[mods.extra]\nkey = \"value\"\n",
+			want: map[string]interface{}{
+				"modLoader": "javafml",
+				"mods": []interface{}{
+					map[string]interface{}{"modId": "one"},
+					map[string]interface{}{"modId": "two", "extra": map[string]interface{}{"key": "value"}},
+				},
+				"dependencies": map[string]interface{}{"two": []interface{}{map[string]interface{}{"modId": "forge"}}},
+			},
+		},
+		{
+			name: "arrays and inline tables",
+			data: "list = [\n  1, # one\n  2,\n]\nnested = [[\"a\"], []]\npoint = { x = 1, y.z = \"two\" }\n",
+			want: map[string]interface{}{
+				"list":   []interface{}{int64(1), int64(2)},
+				"nested": []interface{}{[]interface{}{"a"}, []interface{}{}},
+				"point":  map[string]interface{}{"x": int64(1), "y": map[string]interface{}{"z": "two"}},
+			},
+		},
+		{
+			name: "crlf",
+			data: "[a]\r\nb = \"c\"\r\n",
+			want: map[string]interface{}{"a": map[string]interface{}{"b": "c"}},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseTOML(test.data)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []string{
+		"a = \"unterminated\n",
+		"a = \"bad \\q escape\"\n",
+		"a = [1, 2\n",
+		"a = { b = 1\n",
+		"a = 1 b = 2\n",
+		"[a\n",
+		"= 1\n",
+		"a = 1\n[a]\n",
+	}
+
+	for _, data := range tests {
+		_, err := parseTOML(data)
+		if err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestParseTOMLRoundTrip(t *testing.T) {
+	// Values written as quoted TOML strings must parse back to themselves.
+	values := []string{"", "plain", "tab\tnewline\n", "quote \" and backslash \\", "unicode é 😀", "'single'"}
+	for _, value := range values {
+		got, err := parseTOML("key = " + strconv.Quote(value) + "\n")
+		if err != nil {
+			t.Errorf("%q: %s", value, err)
+			continue
+		}
+		if got["key"] != value {
+			t.Errorf("%q: parsed back as %q", value, got["key"])
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package mcrunner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// BackupDirectory name of the directory inside the mcserver directory that backups are written to.
+	BackupDirectory = "backups"
+	// UpgradeTimeout is how long an upgraded server has to finish starting before it is rolled back.
+	UpgradeTimeout = 10 * time.Minute
+	// WorldDirectory name of the world directory inside the mcserver directory when level-name isn't set.
+	WorldDirectory = "world"
+)
+
+// errUpgrading is returned for requests that can't be handled while an upgrade is in progress.
+var errUpgrading = fmt.Errorf("an upgrade is in progress, try again once it finishes")
+
+// errUpgradeStopped is returned by an upgrade the server was stopped or killed during.
+var errUpgradeStopped = fmt.Errorf("the server was stopped during the upgrade")
+
+// UpgradeVersions are the versions an upgrade installs, empty fields keep the current setting.
+type UpgradeVersions struct {
+	Loader               string
+	MinecraftVersion     string
+	LoaderVersion        string
+	LaunchWrapperVersion string
+	InstallerVersion     string
+}
+
+// apply returns settings with the versions from upgrade.
+func (upgrade UpgradeVersions) apply(settings Settings) Settings {
+	if upgrade.Loader != "" {
+		settings.Loader = upgrade.Loader
+	}
+	if upgrade.MinecraftVersion != "" {
+		settings.MinecraftVersion = upgrade.MinecraftVersion
+	}
+	if upgrade.LoaderVersion != "" {
+		settings.LoaderVersion = upgrade.LoaderVersion
+	}
+	if upgrade.LaunchWrapperVersion != "" {
+		settings.LaunchWrapperVersion = upgrade.LaunchWrapperVersion
+	}
+	if upgrade.InstallerVersion != "" {
+		settings.InstallerVersion = upgrade.InstallerVersion
+	}
+	return settings
+}
+
+// snapshot is a copy of the installed server files taken before an upgrade.
+type snapshot struct {
+	Path string
+	// Files are the paths relative to the mcserver directory that were copied.
+	Files []string
+}
+
+// copyTree copies the file or directory src to dst, keeping file modes.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		err = copyFile(path, target)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(target, info.Mode().Perm())
+	})
+}
+
+// takeSnapshot copies the files installed for info, the libraries, the world named world with its
+// nether and end, and the install info into a new directory under BackupDirectory.
+func takeSnapshot(info InstallInfo, world string) (*snapshot, error) {
+	loader, err := GetLoader(info.Loader)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &snapshot{Path: filepath.Join(McServerPath(), BackupDirectory, "upgrade-"+time.Now().Format("20060102-150405"))}
+	candidates := append(loader.InstalledFiles(info), "libraries", world, world+"_nether", world+"_the_end", InstallInfoFile)
+	seen := make(map[string]bool)
+	for _, file := range candidates {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		_, err := os.Stat(filepath.Join(McServerPath(), file))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		err = copyTree(filepath.Join(McServerPath(), file), filepath.Join(snapshot.Path, file))
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Files = append(snapshot.Files, file)
+	}
+	return snapshot, nil
+}
+
+// restore removes the files installed for installed and puts the snapshot's files back in their place.
+func (snapshot *snapshot) restore(installed InstallInfo) error {
+	remove := snapshot.Files
+	if loader, err := GetLoader(installed.Loader); err == nil {
+		remove = append(loader.InstalledFiles(installed), remove...)
+	}
+	for _, file := range remove {
+		err := os.RemoveAll(filepath.Join(McServerPath(), file))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range snapshot.Files {
+		err := copyTree(filepath.Join(snapshot.Path, file), filepath.Join(McServerPath(), file))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneBackups deletes the oldest backups in BackupDirectory whose names start with prefix, e.g.
+// "upgrade-", so that no more than keep are left. keep 0 keeps them all.
+func pruneBackups(prefix string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	dir := filepath.Join(McServerPath(), BackupDirectory)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// The names end in a timestamp, so they sort oldest first.
+	var backups []string
+	for _, file := range files {
+		if file.IsDir() && strings.HasPrefix(file.Name(), prefix) {
+			backups = append(backups, file.Name())
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > keep {
+		fmt.Println(fmt.Sprintf("Deleting old backup %s", backups[0]))
+		err = os.RemoveAll(filepath.Join(dir, backups[0]))
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// upgradeInProgress returns true while an upgrade runs in the background.
+func (runner *McRunner) upgradeInProgress() bool {
+	return atomic.LoadInt32(&runner.upgrading) == 1
+}
+
+// upgradeRefuses returns true if command can't run during the upgrade in progress, telling the bot
+// why. Stopping and killing the server are passed to the upgrade, which rolls back and leaves it
+// stopped, so the server is only ever started and stopped by one goroutine. Saving and console
+// commands are let through as they are.
+func (runner *McRunner) upgradeRefuses(command *Command) bool {
+	if !runner.upgradeInProgress() {
+		return false
+	}
+
+	args := strings.Fields(command.Command)
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "stop", "kill":
+		select {
+		case <-runner.upgradeStop:
+		default:
+			fmt.Println(fmt.Sprintf("Got %s, rolling back the upgrade and leaving the server stopped", args[0]))
+			close(runner.upgradeStop)
+		}
+		return true
+	case "start", "reboot", "forcereboot":
+		fmt.Println(fmt.Sprintf("Ignoring %s, %s", args[0], errUpgrading))
+		return true
+	}
+	if _, ok := runnerCommands[args[0]]; ok {
+		runner.sendResult(command, nil, errUpgrading)
+		return true
+	}
+	return false
+}
+
+// waitUntilRunning waits for the server to finish starting, returning an error if it exits first,
+// stop is closed or it takes longer than timeout.
+func (runner *McRunner) waitUntilRunning(timeout time.Duration, stop <-chan bool) error {
+	runner.processMutex.Lock()
+	exited := runner.exited
+	runner.processMutex.Unlock()
+	deadline := time.After(timeout)
+	for runner.state() != Running {
+		select {
+		case <-exited:
+			return fmt.Errorf("server exited before it finished starting")
+		case <-stop:
+			return errUpgradeStopped
+		case <-deadline:
+			return fmt.Errorf("server didn't finish starting within %s", timeout)
+		case <-time.After(1 * time.Second):
+		}
+	}
+	return nil
+}
+
+// stopped returns true if stop has been closed.
+func stopped(stop <-chan bool) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Upgrade stops the server, backs up the installed files and world, and installs the versions in
+// upgrade. The upgraded server is then booted, and if it crashes or doesn't finish starting within
+// timeout the backup is restored, as it is when stop is closed. Either way the server is left
+// running only if it was before and stop wasn't closed. Old upgrade backups past Settings.BackupsKept
+// are deleted.
+func (runner *McRunner) Upgrade(upgrade UpgradeVersions, timeout time.Duration, stop <-chan bool) error {
+	previousSettings := runner.currentSettings()
+	settings := upgrade.apply(previousSettings)
+	err := settings.Validate()
+	if err == nil {
+		err = checkOverrides(settings)
+	}
+	if err != nil {
+		fmt.Println("Upgrade:", err)
+		return err
+	}
+
+	previous, err := ReadInstallInfo()
+	if err != nil {
+		fmt.Println("Upgrade: ReadInstallInfo:", err)
+		return fmt.Errorf("nothing is installed to upgrade from: %s", err)
+	}
+
+	wasRunning := runner.processRunning()
+	err = runner.Stop(StopTimeout)
+	if err != nil {
+		fmt.Println("Upgrade: Stop:", err)
+		return err
+	}
+	if stopped(stop) {
+		fmt.Println("Upgrade:", errUpgradeStopped)
+		return errUpgradeStopped
+	}
+
+	fmt.Println("Backing up server before upgrade")
+	snapshot, err := takeSnapshot(*previous, runner.worldName())
+	if err != nil {
+		fmt.Println("Upgrade: takeSnapshot:", err)
+		return err
+	}
+
+	runner.replaceSettings(settings)
+	err = runner.Install()
+	if err == nil && stopped(stop) {
+		err = errUpgradeStopped
+	}
+	if err == nil {
+		err = runner.startServer(false)
+	}
+	if err == nil {
+		err = runner.waitUntilRunning(timeout, stop)
+	}
+
+	if err != nil {
+		fmt.Println("Upgrade failed, rolling back:", err)
+		runner.Kill()
+		installed := runner.wantedInstallInfo()
+		runner.replaceSettings(previousSettings)
+		restoreErr := snapshot.restore(installed)
+		if restoreErr != nil {
+			fmt.Println("Upgrade: restore:", restoreErr)
+			return fmt.Errorf("%s, and rolling back failed: %s (backup is in %s)", err, restoreErr, snapshot.Path)
+		}
+		if wasRunning && !stopped(stop) {
+			runner.Start()
+		}
+		return fmt.Errorf("upgrade failed and was rolled back: %s", err)
+	}
+
+	if wasRunning && !stopped(stop) {
+		runner.processMutex.Lock()
+		runner.keepAlive = true
+		runner.processMutex.Unlock()
+	} else {
+		runner.Stop(StopTimeout)
+	}
+	// Installing a modpack can change the versions, so the settings it left are the ones saved.
+	settings = runner.currentSettings()
+	err = SaveSettings(settings)
+	if err != nil {
+		fmt.Println("Upgrade: SaveSettings:", err)
+		return err
+	}
+	err = pruneBackups("upgrade-", settings.BackupsKept)
+	if err != nil {
+		fmt.Println("Upgrade: pruneBackups:", err)
+	}
+	fmt.Println(fmt.Sprintf("Upgraded to %s %s for Minecraft %s, backup is in %s", settings.Loader, settings.LoaderVersion, settings.MinecraftVersion, snapshot.Path))
+	return nil
+}
+
+// upgradeCommand handles "upgrade [loader=<name>] [minecraft=<version>] [version=<loader version>]
+// [launchwrapper=<version>] [installer=<version>]". The result is sent once the upgrade finishes.
+func (runner *McRunner) upgradeCommand(command *Command, args []string) (interface{}, error) {
+	usage := fmt.Errorf("usage: upgrade [loader=<name>] [minecraft=<version>] [version=<loader version>] [launchwrapper=<version>] [installer=<version>]")
+	if len(args) == 0 {
+		return nil, usage
+	}
+
+	var upgrade UpgradeVersions
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, usage
+		}
+		switch parts[0] {
+		case "loader":
+			upgrade.Loader = parts[1]
+		case "minecraft":
+			upgrade.MinecraftVersion = parts[1]
+		case "version":
+			upgrade.LoaderVersion = parts[1]
+		case "launchwrapper":
+			upgrade.LaunchWrapperVersion = parts[1]
+		case "installer":
+			upgrade.InstallerVersion = parts[1]
+		default:
+			return nil, usage
+		}
+	}
+
+	if !atomic.CompareAndSwapInt32(&runner.upgrading, 0, 1) {
+		return nil, errUpgrading
+	}
+	stop := make(chan bool)
+	runner.upgradeStop = stop
+
+	// The upgrade can take up to UpgradeTimeout, so it runs in the background where it doesn't hold
+	// up other commands. upgradeRefuses passes stop and kill to it by closing stop.
+	runner.WaitGroup.Add(1)
+	go func() {
+		defer runner.WaitGroup.Done()
+		err := runner.Upgrade(upgrade, UpgradeTimeout, stop)
+		var data interface{}
+		if err == nil {
+			data = runner.wantedInstallInfo()
+		}
+		atomic.StoreInt32(&runner.upgrading, 0)
+		runner.sendResult(command, data, err)
+
+		// A stop that came in after the upgrade last checked is handled like any other.
+		if stopped(stop) && runner.processRunning() {
+			runner.CommandChannel <- &Command{Command: "stop"}
+		}
+	}()
+	return nil, errResultPending
+}
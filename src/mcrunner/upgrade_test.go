@@ -0,0 +1,113 @@
+package mcrunner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgradeStopped(t *testing.T) {
+	dir := useTempRoot(t)
+
+	// The 1.20.4 jar isn't served until the test has sent stop, so it arrives during the install.
+	requested := make(chan bool)
+	release := make(chan bool)
+	jarSHA1 := sha1Hex(testJar)
+	var base string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			fmt.Fprintf(w, `{"versions": [
+				{"id": "1.20.4", "type": "release", "url": "%[1]s/v1/1.20.4.json"},
+				{"id": "1.12.2", "type": "release", "url": "%[1]s/v1/1.12.2.json"}
+			]}`, base)
+		case "/v1/1.20.4.json", "/v1/1.12.2.json":
+			id := filepath.Base(r.URL.Path[:len(r.URL.Path)-len(".json")])
+			fmt.Fprintf(w, `{"id": "%s", "downloads": {"server": {"sha1": "%s", "size": 16, "url": "%s/jars/%[1]s.jar"}}}`, id, jarSHA1, base)
+		case "/jars/1.20.4.jar":
+			close(requested)
+			<-release
+			fmt.Fprint(w, testJar)
+		case "/jars/1.12.2.jar":
+			fmt.Fprint(w, testJar)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	base = server.URL
+	defer server.Close()
+
+	settings := DefaultSettings()
+	settings.MaxRAM = LowestMaxRAM
+	settings.Loader = "vanilla"
+	settings.LoaderVersion = ""
+	settings.LaunchWrapperVersion = ""
+	settings.VersionManifestURL = server.URL + "/manifest.json"
+	settings.Properties = map[string]string{"level-name": "survival"}
+	runner := &McRunner{Settings: settings, ResponseChannel: make(chan *Response, 64)}
+	err := runner.Install()
+	if err != nil {
+		t.Fatal(err)
+	}
+	level := filepath.Join(dir, "survival", "level.dat")
+	err = os.MkdirAll(filepath.Dir(level), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(level, []byte("old"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgrade := &Command{Command: "upgrade minecraft=1.20.4"}
+	if runner.handleRunnerCommand(upgrade); !runner.upgradeInProgress() {
+		t.Fatal("upgrade didn't start")
+	}
+	<-requested
+	err = ioutil.WriteFile(level, []byte("new"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !runner.upgradeRefuses(&Command{Command: "stop"}) {
+		t.Error("stop was let through to run alongside the upgrade")
+	}
+	// Stopping twice doesn't close the channel again.
+	runner.upgradeRefuses(&Command{Command: "kill"})
+	close(release)
+	runner.WaitGroup.Wait()
+
+	var upgradeResult *result
+	for len(runner.ResponseChannel) > 0 {
+		response := <-runner.ResponseChannel
+		if r, ok := response.Data.(result); ok && response.Type == "result" {
+			upgradeResult = &r
+		}
+	}
+	if upgradeResult == nil || upgradeResult.Success {
+		t.Fatalf("upgrade result is %+v, want it to fail", upgradeResult)
+	}
+	if runner.upgradeInProgress() {
+		t.Error("upgrade is still in progress")
+	}
+
+	// The stopped upgrade is rolled back.
+	if mcver := runner.currentSettings().MinecraftVersion; mcver != "1.12.2" {
+		t.Errorf("settings are for %s, want 1.12.2", mcver)
+	}
+	info, err := ReadInstallInfo()
+	if err != nil || info.MinecraftVersion != "1.12.2" {
+		t.Errorf("installed %+v, %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, MinecraftServerJarName("1.20.4"))); !os.IsNotExist(err) {
+		t.Errorf("1.20.4 jar is left behind: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, MinecraftServerJarName("1.12.2"))); err != nil {
+		t.Error(err)
+	}
+	if contents, err := ioutil.ReadFile(level); string(contents) != "old" {
+		t.Errorf("world is %q, %v", contents, err)
+	}
+}
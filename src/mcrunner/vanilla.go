@@ -0,0 +1,160 @@
+package mcrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DefaultVersionManifestURL is the launcher version manifest used when Settings doesn't name one.
+const DefaultVersionManifestURL = "https://piston-meta.mojang.com/mc/game/version_manifest_v2.json"
+
+// VersionManifest is the launcher version manifest listing every Minecraft version.
+type VersionManifest struct {
+	Latest struct {
+		Release  string `json:"release"`
+		Snapshot string `json:"snapshot"`
+	} `json:"latest"`
+	Versions []struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		URL  string `json:"url"`
+		SHA1 string `json:"sha1"`
+	} `json:"versions"`
+}
+
+// VersionDownload describes a single downloadable file in a VersionInfo.
+type VersionDownload struct {
+	SHA1 string `json:"sha1"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"`
+}
+
+// VersionInfo is the per-version JSON referenced by the VersionManifest.
+type VersionInfo struct {
+	ID          string `json:"id"`
+	JavaVersion struct {
+		Component    string `json:"component"`
+		MajorVersion int    `json:"majorVersion"`
+	} `json:"javaVersion"`
+	Downloads map[string]VersionDownload `json:"downloads"`
+}
+
+// Server returns the server jar download for the version.
+func (info *VersionInfo) Server() (VersionDownload, error) {
+	server, ok := info.Downloads["server"]
+	if !ok || server.URL == "" {
+		return server, fmt.Errorf("Minecraft %s has no server download", info.ID)
+	}
+	return server, nil
+}
+
+// JavaMajorVersion returns the Java major version the version requires, defaulting to 8 for
+// old versions that predate the javaVersion field.
+func (info *VersionInfo) JavaMajorVersion() int {
+	if info.JavaVersion.MajorVersion == 0 {
+		return 8
+	}
+	return info.JavaVersion.MajorVersion
+}
+
+// fetchJSON GETs url and decodes the JSON response body into v.
+func fetchJSON(url string, v interface{}) error {
+	response, err := downloadClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// ResolveVersion looks up mcver in the version manifest and fetches its VersionInfo.
+// mcver may also be "release" or "snapshot" to select the latest of either.
+func (runner *McRunner) ResolveVersion(mcver string) (*VersionInfo, error) {
+	manifestURL := runner.versionManifestURL()
+	manifest := new(VersionManifest)
+	err := runner.fetchJSON(manifestURL, manifest)
+	if err != nil {
+		fmt.Println("ResolveVersion: fetching manifest:", err)
+		return nil, err
+	}
+
+	switch mcver {
+	case "release":
+		mcver = manifest.Latest.Release
+	case "snapshot":
+		mcver = manifest.Latest.Snapshot
+	}
+
+	for _, version := range manifest.Versions {
+		if version.ID != mcver {
+			continue
+		}
+
+		info := new(VersionInfo)
+		err = runner.fetchJSON(version.URL, info)
+		if err != nil {
+			fmt.Println("ResolveVersion: fetching version:", err)
+			return nil, err
+		}
+		return info, nil
+	}
+
+	return nil, fmt.Errorf("Minecraft version %s not found in %s", mcver, manifestURL)
+}
+
+// versionManifestURL returns the version manifest URL from Settings, or the default.
+func (runner *McRunner) versionManifestURL() string {
+	settings := runner.currentSettings()
+	if settings.VersionManifestURL != "" {
+		return settings.VersionManifestURL
+	}
+	return DefaultVersionManifestURL
+}
+
+// VanillaLoader installs and launches the unmodded Minecraft server.
+type VanillaLoader struct{}
+
+// Name returns "vanilla".
+func (VanillaLoader) Name() string {
+	return "vanilla"
+}
+
+// Install downloads the vanilla server jar for the version in Settings.
+func (VanillaLoader) Install(runner *McRunner) error {
+	return runner.InstallMinecraftServerJar(runner.currentSettings().MinecraftVersion)
+}
+
+// LaunchTarget returns the vanilla server jar.
+func (VanillaLoader) LaunchTarget(mcver, loaderver string) string {
+	return MinecraftServerJarName(mcver)
+}
+
+// LaunchArgs runs the vanilla server jar.
+func (VanillaLoader) LaunchArgs(mcver, loaderver string) []string {
+	return []string{"-jar", MinecraftServerJarName(mcver)}
+}
+
+// InstalledFiles returns the vanilla server jar.
+func (VanillaLoader) InstalledFiles(info InstallInfo) []string {
+	return []string{MinecraftServerJarName(info.MinecraftVersion)}
+}
+
+// TPSCommand returns "", the vanilla server has no TPS command.
+func (VanillaLoader) TPSCommand() string {
+	return ""
+}
+
+// ParseTPS returns nil, the vanilla server has no TPS command.
+func (VanillaLoader) ParseTPS(line string) map[string]float32 {
+	return nil
+}
+
+// LogPatterns returns the vanilla log patterns.
+func (VanillaLoader) LogPatterns() *LogPatterns {
+	return vanillaLogPatterns
+}
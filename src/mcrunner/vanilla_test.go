@@ -0,0 +1,132 @@
+package mcrunner
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveFiles starts a server for files, keyed by path. "{{base}}" in their contents is replaced
+// with the server's URL.
+func serveFiles(t *testing.T, files map[string]string) *httptest.Server {
+	var base string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, strings.Replace(contents, "{{base}}", base, -1))
+	}))
+	base = server.URL
+	t.Cleanup(server.Close)
+	return server
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// testJar is served as every version's server jar.
+const testJar = "not really a jar"
+
+func serveVersionManifest(t *testing.T) *httptest.Server {
+	jarSHA1 := sha1Hex(testJar)
+	return serveFiles(t, map[string]string{
+		"/manifest.json": `{
+			"latest": {"release": "1.20.4", "snapshot": "24w03a"},
+			"versions": [
+				{"id": "24w03a", "type": "snapshot", "url": "{{base}}/v1/24w03a.json", "sha1": "a"},
+				{"id": "1.20.4", "type": "release", "url": "{{base}}/v1/1.20.4.json", "sha1": "b"},
+				{"id": "1.12.2", "type": "release", "url": "{{base}}/v1/1.12.2.json", "sha1": "c"},
+				{"id": "a1.0.4", "type": "old_alpha", "url": "{{base}}/v1/a1.0.4.json", "sha1": "d"}
+			]
+		}`,
+		"/v1/24w03a.json": `{"id": "24w03a", "javaVersion": {"component": "java-runtime-gamma", "majorVersion": 17},
+			"downloads": {"server": {"sha1": "` + jarSHA1 + `", "size": 16, "url": "{{base}}/jars/24w03a.jar"}}}`,
+		"/v1/1.20.4.json": `{"id": "1.20.4", "javaVersion": {"component": "java-runtime-gamma", "majorVersion": 17},
+			"downloads": {"client": {"sha1": "x", "size": 1, "url": "{{base}}/jars/client.jar"},
+				"server": {"sha1": "` + jarSHA1 + `", "size": 16, "url": "{{base}}/jars/1.20.4.jar"}}}`,
+		"/v1/1.12.2.json":  `{"id": "1.12.2", "downloads": {"server": {"sha1": "` + jarSHA1 + `", "size": 16, "url": "{{base}}/jars/1.12.2.jar"}}}`,
+		"/v1/a1.0.4.json":  `{"id": "a1.0.4", "downloads": {}}`,
+		"/jars/24w03a.jar": testJar,
+		"/jars/1.20.4.jar": testJar,
+		"/jars/1.12.2.jar": testJar,
+	})
+}
+
+func TestResolveVersion(t *testing.T) {
+	server := serveVersionManifest(t)
+	runner := &McRunner{Settings: Settings{VersionManifestURL: server.URL + "/manifest.json"}}
+
+	tests := []struct {
+		mcver string
+		id    string
+		java  int
+	}{
+		{"1.20.4", "1.20.4", 17},
+		{"release", "1.20.4", 17},
+		{"snapshot", "24w03a", 17},
+		// Versions from before the javaVersion field run on Java 8.
+		{"1.12.2", "1.12.2", 8},
+	}
+
+	for _, test := range tests {
+		info, err := runner.ResolveVersion(test.mcver)
+		if err != nil {
+			t.Errorf("%s: %s", test.mcver, err)
+			continue
+		}
+		if info.ID != test.id {
+			t.Errorf("%s: resolved to %s, want %s", test.mcver, info.ID, test.id)
+		}
+		if java := info.JavaMajorVersion(); java != test.java {
+			t.Errorf("%s: needs Java %d, want %d", test.mcver, java, test.java)
+		}
+
+		download, err := info.Server()
+		if err != nil {
+			t.Errorf("%s: %s", test.mcver, err)
+			continue
+		}
+		if want := server.URL + "/jars/" + test.id + ".jar"; download.URL != want {
+			t.Errorf("%s: server URL is %s, want %s", test.mcver, download.URL, want)
+		}
+		if download.SHA1 != sha1Hex(testJar) {
+			t.Errorf("%s: server SHA1 is %s", test.mcver, download.SHA1)
+		}
+	}
+
+	if _, err := runner.ResolveVersion("1.0.0"); err == nil {
+		t.Error("1.0.0: expected an error for a version that isn't in the manifest")
+	}
+	info, err := runner.ResolveVersion("a1.0.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := info.Server(); err == nil {
+		t.Error("a1.0.4: expected an error for a version without a server")
+	}
+}
+
+func TestInstallMinecraftServerJar(t *testing.T) {
+	dir := useTempRoot(t)
+	server := serveVersionManifest(t)
+	runner := &McRunner{Settings: Settings{VersionManifestURL: server.URL + "/manifest.json"}}
+
+	err := runner.InstallMinecraftServerJar("1.20.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, MinecraftServerJarName("1.20.4")))
+	if err != nil || string(contents) != testJar {
+		t.Errorf("installed jar is %q, %v", contents, err)
+	}
+}